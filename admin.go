@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+
+	"github.com/rs/zerolog"
+)
+
+// AdminConfig holds configuration for the admin endpoints used to diagnose
+// the running app. The admin endpoints can share the Prometheus port by
+// configuring the same port number.
+type AdminConfig struct {
+	Enabled bool `desc:"Serve the admin endpoints"`
+	Port    int  `default:"9091" validate:"min=1,max=65535" desc:"Port of the admin endpoints"`
+}
+
+// AddAdmin adds pprof, goroutine dump, log level and build info endpoints
+// under /debug/, and the /version and /config endpoints, served by an HTTP
+// server on port. Adding them again on the same port, e.g. when they are
+// also enabled by the environment's profile, has no effect.
+func (a *App) AddAdmin(port int) {
+	if a.adminPorts[port] {
+		return
+	}
+	if a.adminPorts == nil {
+		a.adminPorts = make(map[int]bool)
+	}
+	a.adminPorts[port] = true
+
+	mux := a.muxForPort(port)
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", goroutinesHandler)
+	mux.HandleFunc("/debug/loglevel", a.logLevelHandler)
+	mux.HandleFunc("/debug/buildinfo", buildInfoHandler)
+	mux.HandleFunc("/version", a.versionHandler)
+	mux.HandleFunc("/config", a.configHandler)
+}
+
+// goroutinesHandler writes the stack traces of all current goroutines.
+func goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// logLevelHandler reports the log level of the app, or of the component named
+// by the component parameter, and changes it when a new level is supplied with
+// a PUT or POST request, e.g. level=debug. Setting the level of a component to
+// inherit reverts it to the app's level.
+func (a *App) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	component := r.FormValue("component")
+
+	l, err := a.logLevels.lookup(component)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		lvl, err := parseRuntimeLogLevel(r.FormValue("level"), component != "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		l.SetLevel(lvl)
+		a.logger.Log().Str("component", component).Str("level", l.Level().String()).Msg("Changed log level")
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintln(w, l.Level())
+}
+
+func parseRuntimeLogLevel(s string, component bool) (zerolog.Level, error) {
+	if component && s == "inherit" {
+		return zerolog.NoLevel, nil
+	}
+
+	lvl, err := zerolog.ParseLevel(s)
+	if err != nil || lvl == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q", s)
+	}
+
+	return lvl, nil
+}
+
+// buildInfoHandler writes the build information embedded in the binary as JSON.
+func buildInfoHandler(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
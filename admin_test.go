@@ -0,0 +1,107 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAdmin(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddAdmin(9091)
+
+	require.Len(t, app.httpServers, 1)
+	assert.Equal(t, 9091, app.httpServers[0].httpPort)
+}
+
+func TestAddAdminSharesPrometheusPort(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddPrometheus("/metrics", 9090)
+	app.AddAdmin(9090)
+
+	require.Len(t, app.httpServers, 1)
+
+	for _, path := range []string{"/metrics", "/debug/goroutines", "/debug/pprof/"} {
+		rec := httptest.NewRecorder()
+		app.httpServers[0].httpHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		inLevel  string
+		outCode  int
+		outLevel zerolog.Level
+	}{
+		{name: "get", method: http.MethodGet, outCode: http.StatusOK, outLevel: zerolog.DebugLevel},
+		{name: "put", method: http.MethodPut, inLevel: "error", outCode: http.StatusOK, outLevel: zerolog.ErrorLevel},
+		{name: "post", method: http.MethodPost, inLevel: "info", outCode: http.StatusOK, outLevel: zerolog.InfoLevel},
+		{name: "invalid level", method: http.MethodPut, inLevel: "loud", outCode: http.StatusBadRequest, outLevel: zerolog.DebugLevel},
+		{name: "missing level", method: http.MethodPut, outCode: http.StatusBadRequest, outLevel: zerolog.DebugLevel},
+		{name: "wrong method", method: http.MethodDelete, outCode: http.StatusMethodNotAllowed, outLevel: zerolog.DebugLevel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := NewApp(NewAppConfig("MyApp").Build())
+
+			form := url.Values{}
+			if tc.inLevel != "" {
+				form.Set("level", tc.inLevel)
+			}
+			req := httptest.NewRequest(tc.method, "/debug/loglevel", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			app.logLevelHandler(rec, req)
+
+			assert.Equal(t, tc.outCode, rec.Code)
+			assert.Equal(t, tc.outLevel, app.logLevels.app.Level())
+		})
+	}
+}
+
+func TestGoroutinesHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	goroutinesHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine")
+}
+
+func TestLogLevelHandlerComponent(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.componentLogger("Orders", "", LogSamplingConfig{})
+
+	req := httptest.NewRequest(http.MethodPut, "/debug/loglevel?component=orders&level=error", nil)
+	rec := httptest.NewRecorder()
+	app.logLevelHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	l, err := app.logLevels.lookup("Orders")
+	require.NoError(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, l.Level())
+	assert.Equal(t, zerolog.DebugLevel, app.logLevels.app.Level(), "app level should not change")
+
+	req = httptest.NewRequest(http.MethodPut, "/debug/loglevel?component=orders&level=inherit", nil)
+	rec = httptest.NewRecorder()
+	app.logLevelHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, zerolog.DebugLevel, l.Level(), "component should inherit app level")
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/loglevel?component=unknown", nil)
+	rec = httptest.NewRecorder()
+	app.logLevelHandler(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -2,34 +2,94 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/aws/aws-sdk-go/aws/session"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // App holds config and state comprising the app.
 type App struct {
-	config      AppConfig
-	httpServers []*httpState
-	sqsWorkers  []*sqsWorkerState
-	tasks       []*taskState
-	wg          *sync.WaitGroup
-	cancel      context.CancelFunc
-	logger      zerolog.Logger
-	Metrics     *Metrics
+	config          AppConfig
+	initialConfig   AppConfig
+	httpServers     []*httpState
+	grpcServers     []*grpcState
+	grpcMetrics     *grpcMetrics
+	grpcMetricsOnce sync.Once
+	sqsWorkers      []*sqsWorkerState
+	tasks           []*taskState
+	wg              *sync.WaitGroup
+	cancel          context.CancelFunc
+	onShutdown      []func()
+	onShutdownMu    sync.Mutex
+	logger          zerolog.Logger
+	logOutput       *logOutput
+	logLevels       *logLevels
+	logSampling     *logSampling
+	logDropped      *prometheus.CounterVec
+	tracerProvider  *sdktrace.TracerProvider
+	muxes           map[int]*http.ServeMux
+	adminPorts      map[int]bool
+	promEndpoints   map[promEndpoint]bool
+	configLayers    *configLayers
+	awsSess         *session.Session
+	awsSessionOnce  sync.Once
+	versionInfo     VersionInfo
+	envPrefix       string
+	printConfigAs   string
+	reloaders       []func() error
+	reloadMu        sync.Mutex
+	stdout          io.Writer
+	exit            func(code int)
+	commandArgs     []string
+	userCommands    []command
+	Metrics         *Metrics
+	Meter           Meter
+	Health          *Health
+	Flags           *Flags
 }
 
 // AppConfig holds configuration data for the app.
 type AppConfig struct {
-	Name       string
-	Env        string `default:"dev"`
+	Name       string `desc:"Name of the app"`
+	Env        string `default:"dev" desc:"Environment the app is running in: dev, test, staging, prod or your own"`
+	Version    string `desc:"Version of the app, overriding the build version"`
+	Log        LogConfig
 	Prometheus PrometheusConfig
+	StatsD     StatsDConfig
+	Health     HealthConfig
+	Admin      AdminConfig
+	Tracing    TracingConfig
+	Secrets    SecretsConfig
+	Shutdown   ShutdownConfig
+	Reload     ReloadConfig
+	logger     *zerolog.Logger
+	logWriter  io.Writer
+	args       []string
+	profiles   map[string]map[string]string
+	prefix     string
+	flags      FlagProvider
+}
+
+// ShutdownConfig holds configuration controlling how the app shuts down.
+// Delay is the time to wait after reporting the app as not ready, allowing
+// load balancers to deregister it, before HTTP servers are shutdown. Timeout
+// is the maximum time to wait for connections to drain before they are
+// forcibly closed.
+type ShutdownConfig struct {
+	Delay   time.Duration `default:"0s" desc:"Time to wait after reporting not ready before shutting down"`
+	Timeout time.Duration `default:"30s" desc:"Time allowed for servers to drain when shutting down"`
 }
 
 // NewAppConfig returns a pointer to a new AppConfig.
@@ -47,65 +107,304 @@ func (c AppConfig) WithMetrics(prefix string) AppConfig {
 	return c
 }
 
+// WithLogger uses logger as the app's logger in place of the configured
+// log output and format.
+func (c AppConfig) WithLogger(logger zerolog.Logger) AppConfig {
+	c.logger = &logger
+
+	return c
+}
+
+// WithLogWriter writes the app's logs to w in place of the configured
+// log output, e.g. to capture logs in tests.
+func (c AppConfig) WithLogWriter(w io.Writer) AppConfig {
+	c.logWriter = w
+
+	return c
+}
+
+// WithArgs reads configuration flags from args in place of the command-line
+// arguments of the process.
+func (c AppConfig) WithArgs(args ...string) AppConfig {
+	c.args = append([]string{}, args...)
+
+	return c
+}
+
+// WithEnvPrefix sets the prefix of the app's environment variable names, e.g.
+// HTTP_PROXY, in place of the prefix derived from the app name.
+func (c AppConfig) WithEnvPrefix(prefix string) AppConfig {
+	c.prefix = prefix
+
+	return c
+}
+
+// WithFlagProvider evaluates the app's feature flags against the definitions
+// of p in place of those in its configuration.
+func (c AppConfig) WithFlagProvider(p FlagProvider) AppConfig {
+	c.flags = p
+
+	return c
+}
+
 // Build returns a finalised copy of the working AppConfig instance.
 func (c AppConfig) Build() AppConfig {
 	return c
 }
 
-// NewApp creates a new App. name is expected to be in upper camelcase format.
+// NewApp creates a new App. name is expected to be in upper camelcase format,
+// and its words, with acronyms and digits, form the prefix of the app's
+// environment variable names, e.g. HTTP_PROXY for HTTPProxy.
 func NewApp(config AppConfig) *App {
-	logger := newLogger(config.Name)
+	start := time.Now()
+
+	output := &logOutput{}
+	logger, err := newConfiguredLogger(config, output)
+	if err != nil {
+		logger = zerolog.New(os.Stderr).With().Str("appName", config.Name).Logger()
+		logger.Fatal().Err(err).Msg("Cannot create logger")
+	}
 
 	if !validateAppName(config.Name) {
 		logger.Fatal().Msg("Invalid app name")
 	}
 
+	if !validateEnvPrefix(config.envPrefix()) {
+		logger.Fatal().Str("envPrefix", config.envPrefix()).Msg("Invalid environment variable prefix")
+	}
+
 	app := &App{
-		config: config,
-		wg:     &sync.WaitGroup{},
-		logger: logger,
+		config:        config,
+		initialConfig: config,
+		wg:            &sync.WaitGroup{},
+		logger:        logger,
+		logOutput:     output,
+		stdout:        os.Stdout,
+		exit:          os.Exit,
+		envPrefix:     config.envPrefix(),
+		Health:        NewHealth(),
 	}
 
-	if _, err := os.Stat(".env"); err == nil {
-		if err := godotenv.Load(); err != nil {
-			logger.Fatal().Err(err).Msg("Error loading .env file")
-		}
+	if legacy := legacyEnvPrefix(config.Name); config.prefix == "" && legacy != "" && legacy != app.envPrefix {
+		logger.Warn().Str("envPrefix", app.envPrefix).Str("legacyEnvPrefix", legacy).Msg("Environment variable prefix differs from earlier versions, rename variables or use WithEnvPrefix to keep the old prefix")
+	}
+
+	args := config.args
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	app.commandArgs = parseCommandArgs(args)
+
+	profile := profileEnv(app.envPrefix, parseConfigFlags(args))
+
+	dotenvFiles, err := loadDotenvFiles(profile, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error loading .env file")
+	}
+
+	app.configLayers, err = newConfigLayers(os.Getenv(configFileEnvName(app.envPrefix)), args)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Cannot read config file")
 	}
+	app.configLayers.defaults = config.profileDefaults(profile)
+	app.configLayers.secrets = newSecretResolver(app.awsSession)
+	app.printConfigAs = app.configLayers.flags["printconfig"]
 
 	if err := app.ReadConfig(&app.config); err != nil {
 		logger.Fatal().Err(err).Msg("Error reading core app configuration")
 	}
 
-	app.logger = loggerForEnv(logger, app.config.Env)
-	app.Metrics = NewMetrics(app.config.Prometheus)
+	if err := checkProdDotenv(app.config.Env, profile, dotenvFiles); err != nil {
+		logger.Fatal().Err(err).Strs("files", dotenvFiles).Msg("Invalid environment")
+	}
+
+	// The environment was set in a .env or config file, so read the
+	// configuration again with the defaults of its profile.
+	if env := app.config.Env; env != profile {
+		app.config = config
+		app.configLayers.defaults = config.profileDefaults(env)
+		if err := app.ReadConfig(&app.config); err != nil {
+			logger.Fatal().Err(err).Msg("Error reading core app configuration")
+		}
+	}
+	app.configLayers.secrets.ttl = app.config.Secrets.CacheTTL
+
+	logger, err = newConfiguredLogger(app.config, app.logOutput)
+	if err != nil {
+		app.logger.Fatal().Err(err).Msg("Invalid log configuration")
+	}
+
+	logLevel, err := appLogLevel(app.config)
+	if err != nil {
+		app.logger.Fatal().Err(err).Msg("Invalid log configuration")
+	}
+
+	app.logSampling, err = newLogSampling(app.config.Log.Sampling)
+	if err != nil {
+		app.logger.Fatal().Err(err).Msg("Invalid log configuration")
+	}
+
+	app.versionInfo = resolveVersionInfo(app.config, start)
+	app.config.Version = app.versionInfo.Version
+	logger = versionLogger(logger, app.versionInfo)
+
+	promConfig := app.config.Prometheus
+	promConfig.ConstLabels = appConstLabels(app.config)
+	app.Metrics = NewMetrics(promConfig)
+	app.Metrics.registerAppInfo(app.versionInfo)
+	app.Meter = app.Metrics
+
+	if app.config.StatsD.Enabled {
+		m, err := newStatsDMeter(app.config.StatsD, promConfig.ConstLabels)
+		if err != nil {
+			app.logger.Fatal().Err(err).Msg("Cannot create StatsD meter")
+		}
+		app.Meter = m
+	}
+
+	app.logDropped = app.Metrics.NewCounterVec("log_dropped_total", "The total number of log events dropped by sampling", []string{"level", "component"})
+	app.logLevels = newLogLevels(logLevel)
+	app.logger = logger.Sample(&logSampler{level: app.logLevels.app, sampling: app.logSampling, dropped: app.logDropped})
+	app.onReload(app.reloadLogLevel)
+
+	flags := app.config.flags
+	if flags == nil {
+		p, err := newConfigFlagProvider(app.configLayers, app.envPrefix)
+		if err != nil {
+			app.logger.Fatal().Err(err).Msg("Invalid feature flags")
+		}
+		app.onReload(p.reload)
+		flags = p
+	}
+	app.Flags = newFlags(flags, app.Metrics)
+
+	if app.config.Tracing.Enabled {
+		if err := app.setupTracing(context.Background()); err != nil {
+			app.logger.Fatal().Err(err).Msg("Cannot setup tracing")
+		}
+	}
 
 	if app.config.Prometheus.Enabled {
 		app.AddPrometheus(app.config.Prometheus.Path, app.config.Prometheus.Port)
 	}
 
+	if app.config.Health.Enabled {
+		app.AddHealth(app.config.Health.LivePath, app.config.Health.ReadyPath, app.config.Health.Port)
+	}
+
+	if app.config.Admin.Enabled {
+		app.AddAdmin(app.config.Admin.Port)
+	}
+
 	return app
 }
 
-// ReadConfig will read configuration environment variables into c. The supplied name elements
-// are appended to the app name to form a full environment variable name.
-func (a App) ReadConfig(c interface{}, name ...string) error {
-	splitAppName := splitUpperCamelCase(a.config.Name)
-	path := append(splitAppName, name...)
-	return ReadEnvConfig(c, path...)
+// ReadConfig will read configuration into c from the config file, environment
+// variables and command-line flags, over the defaults in its struct tags. The
+// supplied name elements are appended to the app name to form a full
+// environment variable name, and form the key path of c's section in the
+// config file and flags, e.g. ReadConfig(c, "Foo") reads the Bar field from
+// foo.bar in the config file, MY_APP_FOO_BAR and --foo.bar.
+func (a *App) ReadConfig(c interface{}, name ...string) error {
+	envPrefix := a.envPrefix
+	if len(name) > 0 {
+		envPrefix += "_" + BuildEnvConfigName(append([]string{}, name...)...)
+	}
+	if err := a.configLayers.load(c, envPrefix, name); err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+	return nil
+}
+
+// configFileEnvName returns the name of the environment variable holding the
+// path of the app's config file, e.g. MY_APP_CONFIG_FILE.
+func configFileEnvName(envPrefix string) string {
+	return envPrefix + "_CONFIG_FILE"
+}
+
+// promEndpoint is the port and path of a Prometheus metrics endpoint.
+type promEndpoint struct {
+	port int
+	path string
 }
 
 // AddPrometheus adds an HTTP server and metrics endpoint to allow collection
-// of Prometheus metrics.
+// of Prometheus metrics. The OpenMetrics format, which includes exemplars, is
+// served to scrapers that request it. Adding the same path on the same port
+// again, e.g. when it is also enabled by the environment's profile, has no
+// effect.
 func (a *App) AddPrometheus(path string, port int) {
-	promMux := http.NewServeMux()
-	promMux.Handle(path, promhttp.InstrumentMetricHandler(a.Metrics.registry, promhttp.HandlerFor(a.Metrics.registry, promhttp.HandlerOpts{})))
-	a.AddHttp(promMux, port)
+	endpoint := promEndpoint{port: port, path: path}
+	if a.promEndpoints[endpoint] {
+		return
+	}
+	if a.promEndpoints == nil {
+		a.promEndpoints = make(map[promEndpoint]bool)
+	}
+	a.promEndpoints[endpoint] = true
+
+	promMux := a.muxForPort(port)
+	promMux.Handle(path, promhttp.InstrumentMetricHandler(a.Metrics.registry, promhttp.HandlerFor(a.Metrics.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+}
+
+// muxForPort returns the ServeMux used by the app's own endpoints on port,
+// adding an HTTP server for it the first time the port is used. This allows
+// endpoints such as metrics and admin to share a port.
+func (a *App) muxForPort(port int) *http.ServeMux {
+	if mux, ok := a.muxes[port]; ok {
+		return mux
+	}
+
+	if a.muxes == nil {
+		a.muxes = make(map[int]*http.ServeMux)
+	}
+
+	mux := http.NewServeMux()
+	a.muxes[port] = mux
+	a.AddHttp(mux, port).state.instrumented = false
+
+	return mux
 }
 
 // Start will start serving or running any added handlers, tasks, etc.
-// The function will block until a call to Stop is made, or an os.Interrupt
-// signal is received.
+// The function will block until a call to Stop is made, or an os.Interrupt or
+// SIGTERM signal is received. Command-line arguments other than configuration
+// flags are ignored, see Run for an app with commands. When the --print-config
+// flag is given, the app's configuration is printed to stdout instead, e.g.
+// --print-config for the effective values, or --print-config=markdown or
+// --print-config=env for a reference of every variable. The log file, if the
+// app logs to one, is closed when Start returns.
 func (a *App) Start() {
+	defer a.logOutput.Close()
+
+	if a.printConfigAs != "" {
+		if err := a.printConfig(a.stdout, a.printConfigAs); err != nil {
+			a.logger.Fatal().Err(err).Msg("Cannot print configuration")
+		}
+		return
+	}
+
+	a.serve()
+}
+
+// Run runs the command given as the first command-line argument, e.g. config
+// print, health or a command added with AddCommand, or starts the app as Start
+// does if there is none. A failed command exits the process with a non-zero
+// status.
+func (a *App) Run() {
+	defer a.logOutput.Close()
+
+	if err := a.runCommand(a.commandArgs); err != nil {
+		a.logger.Error().Err(err).Strs("args", a.commandArgs).Msg("Command failed")
+		a.exit(1)
+	}
+}
+
+// serve will start serving or running any added handlers, tasks, etc.
+// The function will block until a call to Stop is made, or an os.Interrupt or
+// SIGTERM signal is received.
+func (a *App) serve() {
 	a.logger.Debug().Msg("Starting app")
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
@@ -113,25 +412,97 @@ func (a *App) Start() {
 	a.cancel = cancel
 
 	a.startHttpServers(ctx)
+	a.startGRPCServers(ctx)
 	a.startSQSWorkers(ctx)
 	a.startTasks(ctx)
+	a.startMetricsPusher(ctx)
+	a.startSecretsRefresh(ctx)
+	a.startConfigReload(ctx)
+
+	a.Health.SetReady(true)
 
 	a.registerStopOnSigTerm()
+	a.registerLogLevelSignals()
 	a.wg.Wait()
+	a.cancel()
+
+	a.shutdownTelemetry()
+}
+
+// shutdownTelemetry pushes the final state of the metrics once everything has
+// stopped, whether through Stop or because all tasks completed, then closes
+// the meter and flushes traces.
+func (a *App) shutdownTelemetry() {
+	a.pushMetrics()
+
+	if c, ok := a.Meter.(io.Closer); ok {
+		c.Close()
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), a.config.Shutdown.Timeout)
+	defer shutdownCancel()
+
+	a.shutdownTracing(shutdownCtx)
 }
 
 // Stop will shutdown any running handlers, tasks, etc and exit the app.
-func (a App) Stop() {
+// The app is first reported as not ready and, after the configured shutdown
+// delay, HTTP and gRPC servers are stopped together and each is given until
+// the shutdown timeout to drain before its connections are closed.
+func (a *App) Stop() {
 	a.logger.Debug().Msg("Stopping app")
 
-	a.stopHttpServers(context.TODO())
+	a.Health.SetReady(false)
+
+	if a.config.Shutdown.Delay > 0 {
+		a.logger.Debug().Dur("delay", a.config.Shutdown.Delay).Msg("Waiting before shutdown")
+		time.Sleep(a.config.Shutdown.Delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Shutdown.Timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		a.stopHttpServers(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		a.stopGRPCServers(ctx)
+	}()
+	wg.Wait()
 
 	a.cancel()
 }
 
-func (a App) registerStopOnSigTerm() {
+// RegisterOnShutdown registers f to be called once when the app's HTTP servers
+// begin shutting down. It can be used to notify long-lived connections, such as
+// SSE streams or websockets, that they should close. It may be called before or
+// after Start, e.g. when a connection is opened, but f is not called if the
+// servers are already shutting down.
+func (a *App) RegisterOnShutdown(f func()) {
+	var once sync.Once
+	onShutdown := func() { once.Do(f) }
+
+	a.onShutdownMu.Lock()
+	defer a.onShutdownMu.Unlock()
+
+	a.onShutdown = append(a.onShutdown, onShutdown)
+	for _, s := range a.httpServers {
+		if s.httpServer != nil {
+			s.httpServer.RegisterOnShutdown(onShutdown)
+		}
+	}
+}
+
+// registerStopOnSigTerm stops the app gracefully when the process is
+// interrupted or receives SIGTERM, as sent by container orchestrators such as
+// Kubernetes and ECS.
+func (a *App) registerStopOnSigTerm() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-c
@@ -139,10 +510,6 @@ func (a App) registerStopOnSigTerm() {
 	}()
 }
 
-func newLogger(name string) zerolog.Logger {
-	return zerolog.New(os.Stderr).With().Str("appName", name).Logger()
-}
-
 func logLevelForEnv(env string) zerolog.Level {
 	var logLevel zerolog.Level
 
@@ -155,8 +522,3 @@ func logLevelForEnv(env string) zerolog.Level {
 
 	return logLevel
 }
-
-func loggerForEnv(logger zerolog.Logger, env string) zerolog.Logger {
-	logLevel := logLevelForEnv(env)
-	return logger.Level(logLevel)
-}
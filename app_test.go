@@ -1,8 +1,17 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -46,6 +55,23 @@ func TestAddPrometheus(t *testing.T) {
 	assert.Len(t, app.httpServers, 1)
 }
 
+func TestAddPrometheusOpenMetrics(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddPrometheus("/metrics", 9090)
+
+	h := app.Metrics.Histogram("duration_seconds", "A histogram", nil, "queue")
+	observeWithExemplar(h, 0.5, map[string]string{"trace_id": "abc123"}, "foo")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	rec := httptest.NewRecorder()
+	app.httpServers[0].httpHandler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, rec.Body.String(), `# {trace_id="abc123"} 0.5`)
+}
+
 func TestAutoAddPrometheus(t *testing.T) {
 	os.Setenv("MY_APP_PROMETHEUS_ENABLED", "true")
 	defer os.Unsetenv("MY_APP_PROMETHEUS_ENABLED")
@@ -58,6 +84,21 @@ func TestAutoAddPrometheus(t *testing.T) {
 	assert.Equal(t, 9999, app.httpServers[0].httpPort)
 }
 
+func TestAddPrometheusWithProdProfile(t *testing.T) {
+	os.Setenv("MY_APP_ENV", EnvProd)
+	defer os.Unsetenv("MY_APP_ENV")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	require.Len(t, app.httpServers, 1)
+
+	assert.NotPanics(t, func() { app.AddPrometheus(app.config.Prometheus.Path, app.config.Prometheus.Port) })
+	assert.Len(t, app.httpServers, 1)
+
+	rec := httptest.NewRecorder()
+	app.muxes[app.config.Prometheus.Port].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, app.config.Prometheus.Path, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
 func TestLogLevelForEnv(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -76,3 +117,111 @@ func TestLogLevelForEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestStop(t *testing.T) {
+	os.Setenv("MY_APP_SHUTDOWN_DELAY", "100ms")
+	defer os.Unsetenv("MY_APP_SHUTDOWN_DELAY")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.Health.SetReady(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.cancel = cancel
+
+	start := time.Now()
+	stopped := make(chan struct{})
+	go func() {
+		app.Stop()
+		close(stopped)
+	}()
+
+	require.Eventually(t, func() bool { return !app.Health.Ready() }, 50*time.Millisecond, time.Millisecond, "app should report not ready before shutdown")
+	assert.NoError(t, ctx.Err(), "app context cancelled during shutdown delay")
+
+	<-stopped
+
+	assert.False(t, app.Health.Ready())
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond), "shutdown delay not applied")
+	assert.Error(t, ctx.Err(), "app context not cancelled")
+}
+
+func TestStopOnSigTerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.Health.SetReady(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.cancel = cancel
+
+	app.registerStopOnSigTerm()
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGTERM))
+
+	require.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, time.Millisecond, "app not stopped")
+	assert.False(t, app.Health.Ready())
+}
+
+func TestNewAppWithLogWriter(t *testing.T) {
+	os.Setenv("MY_APP_LOG_TIMEFORMAT", "none")
+	defer os.Unsetenv("MY_APP_LOG_TIMEFORMAT")
+
+	buf := &bytes.Buffer{}
+	app := NewApp(NewAppConfig("MyApp").WithLogWriter(buf))
+	app.logger.Debug().Msg("test")
+
+	assert.Equal(t, `{"level":"debug","appName":"MyApp","message":"test"}`+"\n", buf.String())
+}
+
+func TestNewAppLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	config := NewAppConfig("MyApp").Build()
+	config.Log.Output = path
+	os.Setenv("MY_APP_LOG_OUTPUT", path)
+	defer os.Unsetenv("MY_APP_LOG_OUTPUT")
+
+	app := NewApp(config)
+	app.AddTaskFunc(func(ctx context.Context, logger zerolog.Logger) {
+		logger.Warn().Msg("test")
+	})
+
+	require.Len(t, app.logOutput.files, 1, "log file should be opened once")
+	f := app.logOutput.files[path]
+
+	app.Start()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"message":"test"`)
+	assert.Error(t, f.Close(), "log file should be closed")
+}
+
+func TestNewAppEnvPrefix(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     AppConfig
+		env        string
+		outWarning bool
+	}{
+		{name: "derived", config: NewAppConfig("HTTPProxy").Build(), env: "HTTP_PROXY_VERSION", outWarning: true},
+		{name: "override", config: NewAppConfig("HTTPProxy").WithEnvPrefix("HTTPPROXY").Build(), env: "HTTPPROXY_VERSION"},
+		{name: "digits", config: NewAppConfig("S3Sync").Build(), env: "S3_SYNC_VERSION"},
+		{name: "unchanged", config: NewAppConfig("MyApp").Build(), env: "MY_APP_VERSION"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(tc.env, "1.2.3")
+			defer os.Unsetenv(tc.env)
+
+			buf := &bytes.Buffer{}
+			app := NewApp(tc.config.WithLogWriter(buf).WithArgs())
+
+			assert.Equal(t, "1.2.3", app.config.Version)
+			assert.Equal(t, tc.outWarning, strings.Contains(buf.String(), "Environment variable prefix differs from earlier versions"))
+		})
+	}
+}
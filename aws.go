@@ -0,0 +1,18 @@
+package app
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// awsSession returns the AWS session shared by the app's SQS workers and
+// secret resolution, created from the shared AWS config the first time it
+// is needed.
+func (a *App) awsSession() *session.Session {
+	a.awsSessionOnce.Do(func() {
+		a.awsSess = session.Must(session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		}))
+	})
+
+	return a.awsSess
+}
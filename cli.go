@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// healthCheckTimeout is the time allowed for the health command to get a
+// response from the running app.
+const healthCheckTimeout = 5 * time.Second
+
+// CommandFunc runs a command of the app's command line with its arguments,
+// which exclude the command name and configuration flags.
+type CommandFunc func(ctx context.Context, args []string) error
+
+// command is a command of the app's command line. Commands without a name
+// only describe further usage of the preceding command.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         CommandFunc
+}
+
+// AddCommand adds a command to the app's command line, run by Run when name
+// is the first argument, e.g. for one-off jobs such as migrations that need the
+// same configuration, logging and metrics as the app. The context is cancelled
+// when the process is interrupted, and metrics are pushed once the command
+// returns. An error fails the command, exiting with a non-zero status.
+func (a *App) AddCommand(name string, description string, run CommandFunc) {
+	for _, c := range a.commands() {
+		if c.name == name {
+			a.logger.Fatal().Str("command", name).Msg("Command already exists")
+		}
+	}
+
+	a.userCommands = append(a.userCommands, command{name: name, usage: name, description: description, run: a.commandFunc(run)})
+}
+
+// commands returns the built-in commands followed by those added with
+// AddCommand.
+func (a *App) commands() []command {
+	builtin := []command{
+		{name: "serve", usage: "serve", description: "Run the app (default)", run: a.serveCommand},
+		{name: "config", usage: "config print [values|markdown|env]", description: "Print the effective configuration, or a reference of every variable", run: a.configCommand},
+		{usage: "config validate", description: "Check the configuration is valid"},
+		{name: "health", usage: "health [live|ready]", description: "Check the health of the running app, e.g. in a Docker HEALTHCHECK", run: a.healthCommand},
+		{name: "version", usage: "version", description: "Print the version of the app", run: a.versionCommand},
+		{name: "help", usage: "help", description: "Print this help", run: a.helpCommand},
+	}
+
+	return append(builtin, a.userCommands...)
+}
+
+// runCommand runs the command named by the first of args, or starts the app if
+// there are none.
+func (a *App) runCommand(args []string) error {
+	if len(args) == 0 {
+		return a.serveCommand(context.Background(), nil)
+	}
+
+	for _, c := range a.commands() {
+		if c.name != "" && c.name == args[0] {
+			return c.run(context.Background(), args[1:])
+		}
+	}
+
+	return fmt.Errorf("unknown command %q, run help for usage", args[0])
+}
+
+// parseCommandArgs returns the arguments in args that are not flags, and all
+// of those following a -- argument.
+func parseCommandArgs(args []string) []string {
+	var cmdArgs []string
+
+	for i, arg := range args {
+		if arg == "--" {
+			return append(cmdArgs, args[i+1:]...)
+		}
+		if !strings.HasPrefix(arg, "-") {
+			cmdArgs = append(cmdArgs, arg)
+		}
+	}
+
+	return cmdArgs
+}
+
+func (a *App) serveCommand(ctx context.Context, args []string) error {
+	a.Start()
+	return nil
+}
+
+func (a *App) configCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing config command: print or validate")
+	}
+
+	switch args[0] {
+	case "print":
+		format := "values"
+		if len(args) > 1 {
+			format = args[1]
+		}
+		return a.printConfig(a.stdout, format)
+	case "validate":
+		if err := a.configLayers.validate(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(a.stdout, "Configuration is valid")
+		return err
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+func (a *App) healthCommand(ctx context.Context, args []string) error {
+	path := a.config.Health.ReadyPath
+	if len(args) > 0 {
+		switch args[0] {
+		case "live":
+			path = a.config.Health.LivePath
+		case "ready":
+		default:
+			return fmt.Errorf("unknown health check %q", args[0])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://localhost:%d%s", a.config.Health.Port, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("checking health: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check %s returned %s", url, resp.Status)
+	}
+
+	_, err = fmt.Fprintln(a.stdout, resp.Status)
+	return err
+}
+
+func (a *App) versionCommand(ctx context.Context, args []string) error {
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", a.versionInfo.Version)
+	fmt.Fprintf(w, "Commit:\t%s\n", a.versionInfo.Commit)
+	fmt.Fprintf(w, "Go version:\t%s\n", a.versionInfo.GoVersion)
+
+	return w.Flush()
+}
+
+func (a *App) helpCommand(ctx context.Context, args []string) error {
+	return a.writeUsage(a.stdout)
+}
+
+// writeUsage writes the usage of the app's command line to w.
+func (a *App) writeUsage(w io.Writer) error {
+	fmt.Fprintf(w, "Usage: %s [command] [--key.path=value ...]\n\nCommands:\n", filepath.Base(os.Args[0]))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range a.commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.usage, c.description)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nConfiguration is read from %s_* environment variables, flags such as --log.level=debug and the file in %s.\n", a.envPrefix, configFileEnvName(a.envPrefix))
+	return err
+}
+
+// commandFunc wraps run, a command added with AddCommand, to cancel its
+// context when the process is interrupted and to push metrics and flush
+// traces once it returns.
+func (a *App) commandFunc(run CommandFunc) CommandFunc {
+	return func(ctx context.Context, args []string) error {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		defer a.shutdownTelemetry()
+
+		return run(ctx, args)
+	}
+}
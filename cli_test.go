@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCLIApp(t *testing.T, args ...string) (*App, *bytes.Buffer, *int) {
+	app := NewApp(NewAppConfig("MyApp").WithArgs(args...).WithLogWriter(&bytes.Buffer{}).Build())
+
+	var buf bytes.Buffer
+	app.stdout = &buf
+
+	code := -1
+	app.exit = func(c int) { code = c }
+
+	return app, &buf, &code
+}
+
+func TestParseCommandArgs(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+		out  []string
+	}{
+		{name: "none", args: []string{"--log.level=debug"}},
+		{name: "command", args: []string{"config", "--log.level=debug", "print", "-v"}, out: []string{"config", "print"}},
+		{name: "after --", args: []string{"migrate", "--", "--dry-run", "up"}, out: []string{"migrate", "--dry-run", "up"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, parseCommandArgs(tc.args))
+		})
+	}
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		out     string
+		outCode int
+	}{
+		{args: []string{"config", "print"}, out: "MY_APP_ENV=dev\n", outCode: -1},
+		{args: []string{"config", "print", "markdown"}, out: "| `MY_APP_ENV` | string | `dev` |", outCode: -1},
+		{args: []string{"config", "validate"}, out: "Configuration is valid\n", outCode: -1},
+		{args: []string{"config", "check"}, outCode: 1},
+		{args: []string{"config"}, outCode: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.out, func(t *testing.T) {
+			app, out, code := newTestCLIApp(t, tc.args...)
+
+			app.Run()
+
+			assert.Contains(t, out.String(), tc.out)
+			assert.Equal(t, tc.outCode, *code)
+			assert.Empty(t, app.httpServers)
+		})
+	}
+}
+
+func TestRunConfigValidateCommand(t *testing.T) {
+	os.Setenv("MY_APP_LIMITS_LIMIT", "10")
+	defer os.Unsetenv("MY_APP_LIMITS_LIMIT")
+
+	var logs bytes.Buffer
+	app := NewApp(NewAppConfig("MyApp").WithArgs("config", "validate").WithLogWriter(&logs).Build())
+	var out bytes.Buffer
+	app.stdout = &out
+	code := -1
+	app.exit = func(c int) { code = c }
+
+	require.NoError(t, app.ReadConfig(&testReloadConfig{}, "Limits"))
+	os.Setenv("MY_APP_LIMITS_LIMIT", "200")
+
+	app.Run()
+
+	assert.Equal(t, 1, code)
+	assert.Empty(t, out.String())
+	assert.Contains(t, logs.String(), "MY_APP_LIMITS_LIMIT: must be at most 100")
+}
+
+func TestRunHealthCommand(t *testing.T) {
+	health := NewHealth()
+	mux := http.NewServeMux()
+	mux.Handle("/live", health.LiveHandler())
+	mux.Handle("/ready", health.ReadyHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		args    []string
+		ready   bool
+		outCode int
+	}{
+		{name: "ready", args: []string{"health"}, ready: true, outCode: -1},
+		{name: "not ready", args: []string{"health", "ready"}, outCode: 1},
+		{name: "live", args: []string{"health", "live"}, outCode: -1},
+		{name: "unknown check", args: []string{"health", "started"}, ready: true, outCode: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			health.SetReady(tc.ready)
+			app, _, code := newTestCLIApp(t, append(tc.args, "--health.port="+port)...)
+
+			app.Run()
+
+			assert.Equal(t, tc.outCode, *code)
+		})
+	}
+}
+
+func TestRunVersionCommand(t *testing.T) {
+	app, out, code := newTestCLIApp(t, "version", "--version=1.2.3")
+
+	app.Run()
+
+	assert.Contains(t, out.String(), "Version:    1.2.3\n")
+	assert.Equal(t, -1, *code)
+}
+
+func TestRunHelpCommand(t *testing.T) {
+	app, out, _ := newTestCLIApp(t, "help")
+	app.AddCommand("migrate", "Migrate the database", func(ctx context.Context, args []string) error { return nil })
+
+	app.Run()
+
+	assert.Contains(t, out.String(), "  config validate")
+	assert.Contains(t, out.String(), "  migrate  ")
+	assert.Contains(t, out.String(), "Migrate the database\n")
+	assert.Contains(t, out.String(), "MY_APP_CONFIG_FILE")
+}
+
+func TestRunUserCommand(t *testing.T) {
+	testCases := []struct {
+		name    string
+		err     error
+		outCode int
+	}{
+		{name: "success", outCode: -1},
+		{name: "failure", err: errors.New("failed"), outCode: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, code := newTestCLIApp(t, "migrate", "up", "--log.level=debug", "--", "--steps=2")
+
+			var gotArgs []string
+			app.AddCommand("migrate", "Migrate the database", func(ctx context.Context, args []string) error {
+				gotArgs = args
+				return tc.err
+			})
+
+			app.Run()
+
+			assert.Equal(t, []string{"up", "--steps=2"}, gotArgs)
+			assert.Equal(t, tc.outCode, *code)
+			assert.Empty(t, app.httpServers)
+		})
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	app, _, code := newTestCLIApp(t, "frobnicate")
+
+	app.Run()
+
+	assert.Equal(t, 1, *code)
+}
+
+func TestStartIgnoresCommandArgs(t *testing.T) {
+	app, _, code := newTestCLIApp(t, "-addr", ":8080", "--log.level=debug", "input.csv")
+	app.AddTaskFunc(func(ctx context.Context, logger zerolog.Logger) {})
+
+	app.Start()
+
+	assert.Equal(t, -1, *code)
+	assert.True(t, app.Health.Ready())
+}
@@ -2,11 +2,10 @@ package app
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 	"unicode"
-
-	"github.com/kelseyhightower/envconfig"
 )
 
 // ReadEnvConfig will read values from environment variables into the
@@ -14,8 +13,8 @@ import (
 // will become underscore delimited to build the full environment variable
 // name.
 func ReadEnvConfig(c interface{}, path ...string) error {
-	prefix := BuildEnvConfigName(path...)
-	if err := envconfig.Process(prefix, c); err != nil {
+	l := &configLayers{env: os.LookupEnv}
+	if err := l.load(c, BuildEnvConfigName(path...), nil); err != nil {
 		return fmt.Errorf("could not read config: %w", err)
 	}
 	return nil
@@ -30,34 +29,82 @@ func BuildEnvConfigName(name ...string) string {
 	return strings.Join(name, "_")
 }
 
-// validateAppName checks if name has upper camelcase format.
+// validateAppName checks if name has upper camelcase format, optionally
+// with digits, e.g. S3Sync.
 func validateAppName(n string) bool {
-	regex := regexp.MustCompile("^(?:[A-Z][A-Za-z]*)+$")
+	regex := regexp.MustCompile("^[A-Z][A-Za-z0-9]*$")
 
 	return regex.MatchString(n)
 }
 
-func splitUpperCamelCase(s string) []string {
-	if s == "" {
-		return make([]string, 0)
+// validateEnvPrefix checks if prefix is a valid environment variable name.
+func validateEnvPrefix(prefix string) bool {
+	regex := regexp.MustCompile("^[A-Z][A-Z0-9_]*$")
+
+	return regex.MatchString(prefix)
+}
+
+// envPrefix returns the prefix of the app's environment variable names, as
+// set with WithEnvPrefix or else derived from the words of its name, e.g.
+// MY_APP for MyApp.
+func (c AppConfig) envPrefix() string {
+	if c.prefix != "" {
+		return c.prefix
 	}
 
-	if len(s) == 1 {
-		return []string{s}
+	return BuildEnvConfigName(splitUpperCamelCase(c.Name)...)
+}
+
+// legacyEnvPrefix returns the prefix earlier versions derived from the app's
+// name, which split words only where a lower case letter is followed by an
+// upper case one, so HTTPProxy was HTTPPROXY rather than HTTP_PROXY. Names
+// with digits were invalid, so have no legacy prefix.
+func legacyEnvPrefix(name string) string {
+	if strings.ContainsFunc(name, unicode.IsDigit) {
+		return ""
 	}
 
-	runes := []rune(s)
+	runes := []rune(name)
 	var words []string
 	start := 0
 
 	for i := 1; i < len(runes); i++ {
 		if unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i]) {
-			words = append(words, s[start:i])
+			words = append(words, string(runes[start:i]))
 			start = i
 		}
 	}
 
-	words = append(words, s[start:])
+	words = append(words, string(runes[start:]))
+
+	return BuildEnvConfigName(words...)
+}
+
+// splitUpperCamelCase splits s into words at changes of case. A run of upper
+// case letters is an acronym, ending before an upper case letter followed by
+// a lower case one, and digits belong to the word they follow, so HTTPProxy
+// is HTTP Proxy, HttpProxy is Http Proxy and Oauth2Proxy is Oauth2 Proxy.
+func splitUpperCamelCase(s string) []string {
+	runes := []rune(s)
+	words := make([]string, 0)
+	start := 0
+
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		if !unicode.IsUpper(cur) {
+			continue
+		}
+
+		acronymEnd := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	if len(runes) > 0 {
+		words = append(words, string(runes[start:]))
+	}
 
 	return words
 }
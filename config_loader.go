@@ -0,0 +1,578 @@
+package app
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configLayers reads configuration into structs, layering values from the
+// defaults of the environment's profile, an optional config file, environment
+// variables and command-line flags over the defaults in struct tags, each
+// taking precedence over the last.
+//
+// A field is named in the environment by its upper-cased name appended to the
+// prefix, e.g. MY_APP_LOG_LEVEL, as in envconfig, and supports the same
+// default, required, ignored, split_words and envconfig tags. As in envconfig,
+// a name in an envconfig tag falls back to the unprefixed name, e.g.
+// SHARED_QUEUE, and the fields of embedded structs are named as fields of the
+// struct embedding them. In the config file and in flags the field is named
+// by its key path, e.g. log.level in the file or --log.level=debug as a flag. Keys are matched ignoring case,
+// underscores and dashes, so receiveQueue, receive_queue and receive-queue
+// all name the ReceiveQueue field.
+//
+// Once read, fields are validated against their required and validate tags,
+// and structs implementing Validate are validated in full.
+//
+// String and Secret values referring to secrets, e.g. ssm:///db/password, are
+// resolved once all layers have been applied. A secret tag of ssm or
+// secretsmanager resolves values without a scheme from that store.
+type configLayers struct {
+	defaults   map[string]string
+	path       string
+	file       map[string]interface{}
+	env        func(key string) (string, bool)
+	flags      map[string]string
+	secrets    *secretResolver
+	mu         sync.Mutex
+	specs      []configSpec
+	secretKeys map[string]bool
+}
+
+// newConfigLayers returns the config layers for the config file at path, if
+// not empty, the environment and the flags in args.
+func newConfigLayers(path string, args []string) (*configLayers, error) {
+	l := &configLayers{
+		path:  path,
+		env:   os.LookupEnv,
+		flags: parseConfigFlags(args),
+	}
+
+	if err := l.reloadFile(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// reloadFile reads the config file again, if there is one.
+func (l *configLayers) reloadFile() error {
+	if l.path == "" {
+		return nil
+	}
+
+	file, err := readConfigFile(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+
+	return nil
+}
+
+// load reads configuration into the struct pointed to by c, and records it so
+// that the effective configuration can be described. envPrefix is the prefix
+// of the environment variable names of its fields, and keyPath the path of its
+// section in the config file and flags.
+func (l *configLayers) load(c interface{}, envPrefix string, keyPath []string) error {
+	if err := l.read(c, envPrefix, keyPath); err != nil {
+		return err
+	}
+
+	l.record(configSpec{spec: c, envPrefix: envPrefix, keyPath: configKeyPath(keyPath)})
+
+	return nil
+}
+
+// read reads configuration into the struct pointed to by c without recording
+// it. Every problem found reading and validating the fields is reported in a
+// ConfigError.
+func (l *configLayers) read(c interface{}, envPrefix string, keyPath []string) error {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("specification must be a struct pointer")
+	}
+
+	var problems []error
+	l.loadStruct(v.Elem(), envPrefix, configKeyPath(keyPath), &problems)
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+
+	return nil
+}
+
+func (l *configLayers) loadStruct(v reflect.Value, envPrefix string, keyPath []string, problems *[]error) {
+	t := v.Type()
+	found := len(*problems)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("ignored") == "true" {
+			continue
+		}
+
+		if sf.Anonymous {
+			if ev, ok := embeddedConfigStruct(v.Field(i), true); ok {
+				l.loadStruct(ev, envPrefix, keyPath, problems)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		envKey, path := configFieldName(sf, envPrefix, keyPath)
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct && !isConfigDecoder(fv) {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && !isConfigDecoder(fv) {
+			l.loadStruct(fv, envKey, path, problems)
+			continue
+		}
+
+		set, err := l.loadField(fv, sf, envKey, path)
+		if err != nil {
+			*problems = append(*problems, &fieldError{key: envKey, err: err})
+			continue
+		}
+
+		for _, p := range validateConfigField(fv, sf, set) {
+			*problems = append(*problems, &fieldError{key: envKey, err: errors.New(p)})
+		}
+	}
+
+	if len(*problems) > found || !v.CanAddr() || !v.CanInterface() {
+		return
+	}
+
+	if cv, ok := v.Addr().Interface().(configValidator); ok {
+		if err := cv.Validate(); err != nil {
+			key := envPrefix
+			if key == "" {
+				key = strings.Join(keyPath, ".")
+			}
+			*problems = append(*problems, &fieldError{key: key, err: err})
+		}
+	}
+}
+
+// embeddedConfigStruct returns the struct embedded in the field v, whose
+// fields are read as fields of the struct embedding it, as envconfig does. The
+// exported fields of an embedded unexported type are read too, as
+// encoding/json does, unless it is a nil pointer that cannot be set. A nil
+// pointer is set to a new struct if alloc is true.
+func embeddedConfigStruct(v reflect.Value, alloc bool) (reflect.Value, bool) {
+	if v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct && !isConfigDecoder(v) {
+		if v.IsNil() {
+			if !alloc {
+				return reflect.New(v.Type().Elem()).Elem(), true
+			}
+			if !v.CanSet() {
+				return reflect.Value{}, false
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct || isConfigDecoder(v) {
+		return reflect.Value{}, false
+	}
+
+	return v, true
+}
+
+// configFieldName returns the environment variable name and key path of the
+// field sf of the struct read with envPrefix and keyPath.
+func configFieldName(sf reflect.StructField, envPrefix string, keyPath []string) (string, []string) {
+	name := sf.Name
+	if tag := sf.Tag.Get("envconfig"); tag != "" {
+		name = tag
+	} else if sf.Tag.Get("split_words") == "true" {
+		name = strings.Join(splitFieldWords(name), "_")
+	}
+
+	envKey := strings.ToUpper(name)
+	if envPrefix != "" {
+		envKey = envPrefix + "_" + envKey
+	}
+
+	return envKey, append(keyPath[:len(keyPath):len(keyPath)], configKey(name))
+}
+
+var (
+	fieldWordsRegexp   = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	fieldAcronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+// splitFieldWords splits the name of a field tagged split_words into words as
+// envconfig does, so that variable names are unchanged from when it was used,
+// e.g. APIKey is API Key and S3Bucket is S3 Bucket. It is separate from the
+// splitting of app names, which may change without renaming fields.
+func splitFieldWords(name string) []string {
+	var words []string
+
+	for _, w := range fieldWordsRegexp.FindAllString(name, -1) {
+		if m := fieldAcronymRegexp.FindStringSubmatch(w); len(m) == 3 {
+			words = append(words, m[1], m[2])
+		} else {
+			words = append(words, w)
+		}
+	}
+
+	return words
+}
+
+// loadField sets v from each layer in turn, then resolves any secret
+// reference in the resulting value. It reports whether any layer set v, even
+// to a zero value, which satisfies the required tag as in envconfig.
+func (l *configLayers) loadField(v reflect.Value, sf reflect.StructField, envKey string, path []string) (bool, error) {
+	set := false
+
+	if def := sf.Tag.Get("default"); def != "" {
+		set = true
+		if err := setConfigValue(v, def); err != nil {
+			return set, fmt.Errorf("invalid default value: %w", err)
+		}
+	}
+
+	if s, ok := l.defaults[strings.Join(path, ".")]; ok {
+		set = true
+		if err := setConfigValue(v, s); err != nil {
+			return set, fmt.Errorf("invalid profile default: %w", err)
+		}
+	}
+
+	if raw, ok := lookupConfigFile(l.file, path); ok {
+		set = true
+		if err := setConfigValue(v, raw); err != nil {
+			return set, fmt.Errorf("invalid value for config file key %s: %w", strings.Join(path, "."), err)
+		}
+	}
+
+	s, ok := l.env(envKey)
+	if alt := strings.ToUpper(sf.Tag.Get("envconfig")); !ok && alt != "" {
+		s, ok = l.env(alt)
+	}
+	if ok {
+		set = true
+		if err := setConfigValue(v, s); err != nil {
+			return set, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+
+	if s, ok := l.flags[strings.Join(path, ".")]; ok {
+		set = true
+		if err := setConfigValue(v, s); err != nil {
+			return set, fmt.Errorf("invalid value for flag --%s: %w", strings.Join(path, "."), err)
+		}
+	}
+
+	if l.secrets != nil {
+		resolved, err := l.secrets.resolveField(v, sf.Tag.Get("secret"))
+		if err != nil {
+			return set, err
+		}
+		if resolved {
+			l.markSecret(envKey)
+		}
+	}
+
+	return set, nil
+}
+
+// configKey normalises a config file or flag key for matching.
+func configKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", "")
+	return strings.ReplaceAll(key, "-", "")
+}
+
+// configKeyPath normalises each key of keyPath.
+func configKeyPath(keyPath []string) []string {
+	path := make([]string, len(keyPath))
+	for i, k := range keyPath {
+		path[i] = configKey(k)
+	}
+
+	return path
+}
+
+// parseConfigFlags returns the values of flags of the form --key.path=value,
+// keyed by their normalised key path. A flag without a value is true. Other
+// arguments are ignored, and parsing stops at a -- argument.
+func parseConfigFlags(args []string) map[string]string {
+	flags := make(map[string]string)
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(arg[2:], "=")
+		if !ok {
+			value = "true"
+		}
+
+		segments := strings.Split(key, ".")
+		for i, s := range segments {
+			segments[i] = configKey(s)
+		}
+		flags[strings.Join(segments, ".")] = value
+	}
+
+	return flags
+}
+
+// readConfigFile reads the YAML, JSON or TOML config file at path, according
+// to its extension.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	file := make(map[string]interface{})
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &file)
+	case ".json":
+		err = json.Unmarshal(b, &file)
+	case ".toml":
+		err = toml.Unmarshal(b, &file)
+	default:
+		return nil, fmt.Errorf("unknown config file format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %q: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// lookupConfigFile returns the value in file at path.
+func lookupConfigFile(file map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = file
+
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		found := false
+		for k, mv := range m {
+			if configKey(k) == key {
+				v, found = mv, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// configDecoder is implemented by types decoding themselves from a config
+// value, and is compatible with envconfig.Decoder.
+type configDecoder interface {
+	Decode(value string) error
+}
+
+// configSetter is implemented by types decoding themselves from a config
+// value, such as flag.Value, and is compatible with envconfig.Setter.
+type configSetter interface {
+	Set(value string) error
+}
+
+var (
+	configDecoderType     = reflect.TypeOf((*configDecoder)(nil)).Elem()
+	configSetterType      = reflect.TypeOf((*configSetter)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// isConfigDecoder reports whether v decodes itself. It checks the type of v,
+// as v may be an embedded field of an unexported type, which cannot be
+// converted to an interface.
+func isConfigDecoder(v reflect.Value) bool {
+	if !v.CanAddr() {
+		return false
+	}
+
+	t := reflect.PointerTo(v.Type())
+
+	return t.Implements(configDecoderType) || t.Implements(configSetterType) || t.Implements(textUnmarshalerType) || t.Implements(binaryUnmarshalerType)
+}
+
+// setConfigValue sets v from raw, which is either a string, as found in the
+// environment, flags and struct tags, or a value parsed from a config file.
+// Slices and maps given as strings are comma separated, with map keys and
+// values separated by colons, e.g. a:1,b:2.
+func setConfigValue(v reflect.Value, raw interface{}) error {
+	if v.Kind() == reflect.Ptr && !isConfigDecoder(v) {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setConfigValue(v.Elem(), raw)
+	}
+
+	switch raw := raw.(type) {
+	case []interface{}:
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot assign a list to %s", v.Type())
+		}
+		s := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, e := range raw {
+			if err := setConfigValue(s.Index(i), e); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case map[string]interface{}:
+		if v.Kind() != reflect.Map {
+			return fmt.Errorf("cannot assign a map to %s", v.Type())
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(raw))
+		for k, e := range raw {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setConfigValue(key, k); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := setConfigValue(value, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case string:
+		return decodeConfigString(v, raw)
+	default:
+		return decodeConfigString(v, configScalarString(raw))
+	}
+}
+
+// configScalarString formats a scalar parsed from a config file for decoding.
+func configScalarString(raw interface{}) string {
+	switch raw := raw.(type) {
+	case float64:
+		return strconv.FormatFloat(raw, 'f', -1, 64)
+	case time.Time:
+		return raw.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(raw)
+	}
+}
+
+// decodeConfigString sets v from the string s. As with envconfig, types that
+// decode themselves take precedence, in the order Decode, Set, UnmarshalText
+// and UnmarshalBinary, and []byte is set to the bytes of s.
+func decodeConfigString(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		switch d := v.Addr().Interface().(type) {
+		case configDecoder:
+			return d.Decode(s)
+		case configSetter:
+			return d.Set(s)
+		case encoding.TextUnmarshaler:
+			return d.UnmarshalText([]byte(s))
+		case encoding.BinaryUnmarshaler:
+			return d.UnmarshalBinary([]byte(s))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		var elems []interface{}
+		for _, e := range strings.Split(s, ",") {
+			elems = append(elems, strings.TrimSpace(e))
+		}
+		if s == "" {
+			elems = []interface{}{}
+		}
+		return setConfigValue(v, elems)
+	case reflect.Map:
+		entries := make(map[string]interface{})
+		if s != "" {
+			for _, pair := range strings.Split(s, ",") {
+				k, e, ok := strings.Cut(pair, ":")
+				if !ok {
+					return fmt.Errorf("invalid map item %q", pair)
+				}
+				entries[strings.TrimSpace(k)] = strings.TrimSpace(e)
+			}
+		}
+		return setConfigValue(v, entries)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
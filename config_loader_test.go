@@ -0,0 +1,320 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLoaderConfig struct {
+	Level   string `default:"info"`
+	Port    int    `default:"8080"`
+	Timeout time.Duration
+	Enabled bool
+	Tags    []string
+	Limits  map[string]uint32
+	Nested  struct {
+		ReceiveQueue string
+	}
+	Named     string `envconfig:"OTHER_NAME"`
+	SplitName string `split_words:"true"`
+	Skipped   string `ignored:"true"`
+	internal  string
+}
+
+func testConfigLayers(file map[string]interface{}, env map[string]string, args ...string) *configLayers {
+	return &configLayers{
+		file: file,
+		env: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+		flags: parseConfigFlags(args),
+	}
+}
+
+func TestConfigLayersPrecedence(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     map[string]interface{}
+		env      map[string]string
+		args     []string
+		outLevel string
+	}{
+		{name: "default", outLevel: "info"},
+		{name: "file", file: map[string]interface{}{"foo": map[string]interface{}{"level": "warn"}}, outLevel: "warn"},
+		{name: "env over file", file: map[string]interface{}{"foo": map[string]interface{}{"level": "warn"}}, env: map[string]string{"MY_APP_FOO_LEVEL": "error"}, outLevel: "error"},
+		{name: "flag over env", file: map[string]interface{}{"foo": map[string]interface{}{"level": "warn"}}, env: map[string]string{"MY_APP_FOO_LEVEL": "error"}, args: []string{"--foo.level=debug"}, outLevel: "debug"},
+		{name: "other section", file: map[string]interface{}{"bar": map[string]interface{}{"level": "warn"}}, args: []string{"--bar.level=debug"}, outLevel: "info"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &testLoaderConfig{}
+
+			err := testConfigLayers(tc.file, tc.env, tc.args...).load(c, "MY_APP_FOO", []string{"Foo"})
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.outLevel, c.Level)
+		})
+	}
+}
+
+func TestConfigLayersEnv(t *testing.T) {
+	env := map[string]string{
+		"MY_APP_PORT":                "9090",
+		"MY_APP_TIMEOUT":             "5s",
+		"MY_APP_ENABLED":             "true",
+		"MY_APP_TAGS":                "a,b",
+		"MY_APP_LIMITS":              "info:10,debug:5",
+		"MY_APP_NESTED_RECEIVEQUEUE": "queue",
+		"MY_APP_OTHER_NAME":          "named",
+		"MY_APP_SPLITNAME":           "unsplit",
+		"MY_APP_SKIPPED":             "skipped",
+	}
+
+	c := &testLoaderConfig{}
+	require.NoError(t, testConfigLayers(nil, env).load(c, "MY_APP", nil))
+
+	assert.Equal(t, 9090, c.Port)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.True(t, c.Enabled)
+	assert.Equal(t, []string{"a", "b"}, c.Tags)
+	assert.Equal(t, map[string]uint32{"info": 10, "debug": 5}, c.Limits)
+	assert.Equal(t, "queue", c.Nested.ReceiveQueue)
+	assert.Equal(t, "named", c.Named)
+	assert.Empty(t, c.SplitName)
+	assert.Empty(t, c.Skipped)
+}
+
+func TestConfigLayersSplitWords(t *testing.T) {
+	c := &testLoaderConfig{}
+	require.NoError(t, testConfigLayers(nil, map[string]string{"MY_APP_SPLIT_NAME": "split"}).load(c, "MY_APP", nil))
+
+	assert.Equal(t, "split", c.SplitName)
+}
+
+type TestEmbeddedConfig struct {
+	Host string
+}
+
+type testEmbeddedConfig struct {
+	Port int
+}
+
+type testEmbeddingConfig struct {
+	TestEmbeddedConfig
+	testEmbeddedConfig
+	Queue  string `envconfig:"SHARED_QUEUE"`
+	APIKey string `split_words:"true"`
+}
+
+func TestConfigLayersEnvconfigCompatibility(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  map[string]string
+		out  testEmbeddingConfig
+	}{
+		{name: "embedded exported", env: map[string]string{"MY_APP_HOST": "host"}, out: testEmbeddingConfig{TestEmbeddedConfig: TestEmbeddedConfig{Host: "host"}}},
+		{name: "embedded unexported", env: map[string]string{"MY_APP_PORT": "8080"}, out: testEmbeddingConfig{testEmbeddedConfig: testEmbeddedConfig{Port: 8080}}},
+		{name: "envconfig name", env: map[string]string{"MY_APP_SHARED_QUEUE": "prefixed", "SHARED_QUEUE": "unprefixed"}, out: testEmbeddingConfig{Queue: "prefixed"}},
+		{name: "envconfig name fallback", env: map[string]string{"SHARED_QUEUE": "unprefixed"}, out: testEmbeddingConfig{Queue: "unprefixed"}},
+		{name: "split acronym", env: map[string]string{"MY_APP_API_KEY": "key"}, out: testEmbeddingConfig{APIKey: "key"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &testEmbeddingConfig{}
+			require.NoError(t, testConfigLayers(nil, tc.env).load(c, "MY_APP", nil))
+
+			assert.Equal(t, tc.out, *c)
+		})
+	}
+}
+
+func TestConfigLayersEmbeddedKeyPath(t *testing.T) {
+	c := &testEmbeddingConfig{}
+	file := map[string]interface{}{"foo": map[string]interface{}{"host": "file-host"}}
+	require.NoError(t, testConfigLayers(file, nil, "--foo.port=9090").load(c, "MY_APP_FOO", []string{"Foo"}))
+
+	assert.Equal(t, "file-host", c.Host)
+	assert.Equal(t, 9090, c.Port)
+}
+
+func TestConfigVarsEmbedded(t *testing.T) {
+	l := testConfigLayers(nil, nil)
+	require.NoError(t, l.load(&testEmbeddingConfig{}, "MY_APP", nil))
+
+	var envs []string
+	for _, v := range l.vars() {
+		envs = append(envs, v.Env)
+	}
+
+	assert.Equal(t, []string{"MY_APP_HOST", "MY_APP_PORT", "MY_APP_SHARED_QUEUE", "MY_APP_API_KEY"}, envs)
+}
+
+func TestConfigLayersFileValues(t *testing.T) {
+	file := map[string]interface{}{
+		"port":    float64(9090),
+		"timeout": "5s",
+		"enabled": true,
+		"tags":    []interface{}{"a", "b"},
+		"limits":  map[string]interface{}{"info": 10},
+		"nested":  map[string]interface{}{"receive_queue": "queue"},
+	}
+
+	c := &testLoaderConfig{}
+	require.NoError(t, testConfigLayers(file, nil).load(c, "MY_APP", nil))
+
+	assert.Equal(t, 9090, c.Port)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.True(t, c.Enabled)
+	assert.Equal(t, []string{"a", "b"}, c.Tags)
+	assert.Equal(t, map[string]uint32{"info": 10}, c.Limits)
+	assert.Equal(t, "queue", c.Nested.ReceiveQueue)
+}
+
+func TestConfigLayersErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		file   map[string]interface{}
+		env    map[string]string
+		args   []string
+		outErr string
+	}{
+		{name: "invalid env", env: map[string]string{"MY_APP_PORT": "x"}, outErr: "MY_APP_PORT: invalid value"},
+		{name: "invalid file", file: map[string]interface{}{"port": "x"}, outErr: "MY_APP_PORT: invalid value for config file key port"},
+		{name: "invalid flag", args: []string{"--port=x"}, outErr: "MY_APP_PORT: invalid value for flag --port"},
+		{name: "list for scalar", file: map[string]interface{}{"port": []interface{}{"1"}}, outErr: "MY_APP_PORT: invalid value for config file key port"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testConfigLayers(tc.file, tc.env, tc.args...).load(&testLoaderConfig{}, "MY_APP", nil)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.outErr)
+		})
+	}
+}
+
+func TestConfigLayersRequired(t *testing.T) {
+	c := &struct {
+		Queue string `required:"true"`
+	}{}
+
+	err := testConfigLayers(nil, nil).load(c, "MY_APP", nil)
+	assert.EqualError(t, err, "invalid configuration: MY_APP_QUEUE: required value missing")
+
+	require.NoError(t, testConfigLayers(nil, nil, "--queue=foo").load(c, "MY_APP", nil))
+	assert.Equal(t, "foo", c.Queue)
+
+	z := &struct {
+		Count   int  `required:"true"`
+		Enabled bool `required:"true"`
+	}{}
+	require.NoError(t, testConfigLayers(nil, map[string]string{"MY_APP_COUNT": "0", "MY_APP_ENABLED": "false"}).load(z, "MY_APP", nil))
+}
+
+func TestConfigLayersInvalidSpecification(t *testing.T) {
+	assert.Error(t, testConfigLayers(nil, nil).load(testLoaderConfig{}, "MY_APP", nil))
+}
+
+func TestParseConfigFlags(t *testing.T) {
+	flags := parseConfigFlags([]string{"serve", "--log.level=debug", "--prometheus.enabled", "-v", "--Foo.Receive-Queue=q", "--", "--after=1"})
+
+	assert.Equal(t, map[string]string{
+		"log.level":          "debug",
+		"prometheus.enabled": "true",
+		"foo.receivequeue":   "q",
+	}, flags)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		content  string
+	}{
+		{name: "yaml", filename: "config.yaml", content: "foo:\n  level: warn\n  port: 9090\n  tags: [a, b]\n"},
+		{name: "json", filename: "config.json", content: `{"foo": {"level": "warn", "port": 9090, "tags": ["a", "b"]}}`},
+		{name: "toml", filename: "config.toml", content: "[foo]\nlevel = \"warn\"\nport = 9090\ntags = [\"a\", \"b\"]\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.filename)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+
+			l, err := newConfigLayers(path, nil)
+			require.NoError(t, err)
+
+			c := &testLoaderConfig{}
+			require.NoError(t, l.load(c, "MY_TEST_APP_FOO", []string{"Foo"}))
+
+			assert.Equal(t, "warn", c.Level)
+			assert.Equal(t, 9090, c.Port)
+			assert.Equal(t, []string{"a", "b"}, c.Tags)
+		})
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := newConfigLayers(filepath.Join(dir, "missing.yaml"), nil)
+	assert.Error(t, err)
+
+	path := filepath.Join(dir, "config.ini")
+	require.NoError(t, os.WriteFile(path, []byte("level=warn"), 0644))
+	_, err = newConfigLayers(path, nil)
+	assert.EqualError(t, err, `unknown config file format ".ini"`)
+
+	path = filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = newConfigLayers(path, nil)
+	assert.Error(t, err)
+}
+
+func TestNewAppLayeredConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: warn\nfoo:\n  receiveQueue: file-queue\n  endpoint: file-endpoint\n"), 0644))
+
+	os.Setenv("MY_APP_CONFIG_FILE", path)
+	defer os.Unsetenv("MY_APP_CONFIG_FILE")
+	os.Setenv("MY_APP_FOO_ENDPOINT", "env-endpoint")
+	defer os.Unsetenv("MY_APP_FOO_ENDPOINT")
+
+	app := NewApp(NewAppConfig("MyApp").WithArgs("--foo.msg-type-key=type").Build())
+	app.AddSQS("Foo", NewMsgRouter())
+
+	assert.Equal(t, "warn", app.config.Log.Level)
+	require.Len(t, app.sqsWorkers, 1)
+	assert.Equal(t, "file-queue", app.sqsWorkers[0].receiveQueue)
+	assert.Equal(t, "env-endpoint", app.sqsWorkers[0].endpoint)
+	assert.Equal(t, "type", app.sqsWorkers[0].msgTypeKey)
+}
+
+func TestSplitFieldWords(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out []string
+	}{
+		{in: "SplitName", out: []string{"Split", "Name"}},
+		{in: "APIKey", out: []string{"API", "Key"}},
+		{in: "HTTPProxy", out: []string{"HTTP", "Proxy"}},
+		{in: "S3Bucket", out: []string{"S3", "Bucket"}},
+		{in: "OAuth2Token", out: []string{"O", "Auth2", "Token"}},
+		{in: "ID", out: []string{"ID"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			assert.Equal(t, tc.out, splitFieldWords(tc.in))
+		})
+	}
+}
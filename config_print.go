@@ -0,0 +1,339 @@
+package app
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the values of secrets when configuration is printed.
+const redacted = "[REDACTED]"
+
+// configSpec is a struct read by configLayers, recorded so that the effective
+// configuration can be described.
+type configSpec struct {
+	spec      interface{}
+	envPrefix string
+	keyPath   []string
+}
+
+// ConfigVar describes a configuration variable read by the app. Value is the
+// effective value, with the values of secrets redacted.
+type ConfigVar struct {
+	Env         string `json:"env"`
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+	Value       string `json:"value"`
+	Secret      bool   `json:"secret,omitempty"`
+}
+
+// record adds s to the structs read, replacing any of the same type read with
+// the same prefix, as when configuration is read again on reload. Structs of
+// different types read with the same prefix, such as the app's own and one
+// read by ReadConfig without a name, are both kept.
+func (l *configLayers) record(s configSpec) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, r := range l.specs {
+		if r.envPrefix == s.envPrefix && reflect.TypeOf(r.spec) == reflect.TypeOf(s.spec) {
+			l.specs[i] = s
+			return
+		}
+	}
+
+	l.specs = append(l.specs, s)
+}
+
+// markSecret records that the value of the field named envKey was resolved
+// from a secret, so that it is redacted when printed.
+func (l *configLayers) markSecret(envKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.secretKeys == nil {
+		l.secretKeys = make(map[string]bool)
+	}
+
+	l.secretKeys[envKey] = true
+}
+
+// vars describes the fields of every struct read, in the order read.
+func (l *configLayers) vars() []ConfigVar {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var vars []ConfigVar
+
+	for _, s := range l.specs {
+		vars = l.describeStruct(vars, reflect.ValueOf(s.spec).Elem(), s.envPrefix, s.keyPath)
+	}
+
+	return vars
+}
+
+func (l *configLayers) describeStruct(vars []ConfigVar, v reflect.Value, envPrefix string, keyPath []string) []ConfigVar {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("ignored") == "true" {
+			continue
+		}
+
+		if sf.Anonymous {
+			if ev, ok := embeddedConfigStruct(v.Field(i), false); ok {
+				vars = l.describeStruct(vars, ev, envPrefix, keyPath)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		envKey, path := configFieldName(sf, envPrefix, keyPath)
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct && !isConfigDecoder(fv) {
+			if fv.IsNil() {
+				fv = reflect.New(fv.Type().Elem())
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && !isConfigDecoder(fv) {
+			vars = l.describeStruct(vars, fv, envKey, path)
+			continue
+		}
+
+		secret := sf.Tag.Get("secret") != "" || fv.Type() == secretType || l.secretKeys[envKey] || isSensitiveName(sf.Name)
+
+		value := redactURL(configValueString(fv))
+		if secret && value != "" {
+			value = redacted
+		}
+
+		vars = append(vars, ConfigVar{
+			Env:         envKey,
+			Key:         strings.Join(path, "."),
+			Type:        fv.Type().String(),
+			Default:     redactURL(sf.Tag.Get("default")),
+			Required:    sf.Tag.Get("required") == "true",
+			Description: sf.Tag.Get("desc"),
+			Value:       value,
+			Secret:      secret,
+		})
+	}
+
+	return vars
+}
+
+// sensitiveWords are the words of field names whose values are redacted even
+// when not read from a secret store, e.g. DBPassword or APIKey.
+var sensitiveWords = map[string]bool{
+	"password":    true,
+	"passwd":      true,
+	"secret":      true,
+	"token":       true,
+	"credential":  true,
+	"credentials": true,
+	"key":         true,
+}
+
+// isSensitiveName reports whether the field name suggests its value is a
+// secret.
+func isSensitiveName(name string) bool {
+	for _, w := range splitUpperCamelCase(name) {
+		if sensitiveWords[strings.ToLower(w)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactURL removes any user info, such as a password, from s if it is a URL.
+func redactURL(s string) string {
+	if !strings.Contains(s, "@") {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil || u.Host == "" {
+		return s
+	}
+	u.User = nil
+
+	return u.String()
+}
+
+// configValueString formats v in the form read from environment variables.
+func configValueString(v reflect.Value) string {
+	if v.Type() == secretType {
+		return v.Interface().(Secret).Value()
+	}
+
+	if v.CanAddr() {
+		switch m := v.Addr().Interface().(type) {
+		case encoding.TextMarshaler:
+			b, err := m.MarshalText()
+			if err == nil {
+				return string(b)
+			}
+		case fmt.Stringer:
+			return m.String()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return configValueString(v.Elem())
+	case reflect.Slice:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = configValueString(v.Index(i))
+		}
+		return strings.Join(elems, ",")
+	case reflect.Map:
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries = append(entries, configValueString(iter.Key())+":"+configValueString(iter.Value()))
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, ",")
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	}
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// ConfigVars returns every configuration variable read through ReadConfig,
+// with its effective value.
+func (a *App) ConfigVars() []ConfigVar {
+	return a.configLayers.vars()
+}
+
+// WriteConfig writes the effective configuration of the app to w as
+// environment variable assignments, in the format of a .env file.
+func (a *App) WriteConfig(w io.Writer) error {
+	for _, v := range a.ConfigVars() {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", v.Env, envFileValue(v.Value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteConfigReference writes a reference of the configuration variables
+// read by the app to w, with their defaults and the descriptions in their
+// desc struct tags. format is markdown, for a table, or env, for a .env file
+// with optional variables commented out.
+func (a *App) WriteConfigReference(w io.Writer, format string) error {
+	vars := a.ConfigVars()
+
+	switch format {
+	case "markdown":
+		return writeConfigMarkdown(w, vars)
+	case "env":
+		return writeConfigEnvFile(w, vars)
+	default:
+		return fmt.Errorf("unknown config reference format %q", format)
+	}
+}
+
+func writeConfigMarkdown(w io.Writer, vars []ConfigVar) error {
+	fmt.Fprintln(w, "| Variable | Type | Default | Required | Description |")
+	fmt.Fprintln(w, "|---|---|---|---|---|")
+
+	for _, v := range vars {
+		def := ""
+		if v.Default != "" {
+			def = "`" + v.Default + "`"
+		}
+
+		required := ""
+		if v.Required {
+			required = "yes"
+		}
+
+		desc := strings.ReplaceAll(v.Description, "|", `\|`)
+
+		if _, err := fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s |\n", v.Env, v.Type, def, required, desc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeConfigEnvFile(w io.Writer, vars []ConfigVar) error {
+	for i, v := range vars {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		if v.Description != "" {
+			fmt.Fprintf(w, "# %s\n", v.Description)
+		}
+
+		comment := "# "
+		if v.Required {
+			comment = ""
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s=%s\n", comment, v.Env, envFileValue(v.Default)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// envFileValue quotes s if needed to be read back from a .env file.
+func envFileValue(s string) string {
+	if strings.ContainsAny(s, " \t\n#\"'\\") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// printConfig writes the configuration of the app to w as requested by the
+// --print-config flag: the effective values for true or values, otherwise a
+// reference in the given format.
+func (a *App) printConfig(w io.Writer, format string) error {
+	switch format {
+	case "true", "values":
+		return a.WriteConfig(w)
+	default:
+		return a.WriteConfigReference(w, format)
+	}
+}
+
+// configHandler writes the effective configuration of the app as JSON.
+func (a *App) configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.ConfigVars())
+}
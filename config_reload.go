@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReloadConfig holds configuration for reloading configuration while the app
+// is running. Configuration is reloaded when the process receives SIGHUP and,
+// if WatchInterval is set, when the modification time of the config file
+// changes.
+type ReloadConfig struct {
+	WatchInterval time.Duration `desc:"Interval between checks of the config file for changes, if set"`
+}
+
+// Reloadable holds configuration that is read again whenever the app reloads
+// its configuration. Load returns the current value, which must not be
+// modified, and subscribers are notified when a reload changes it.
+type Reloadable[T any] struct {
+	value       atomic.Pointer[T]
+	mu          sync.Mutex
+	subscribers []func(old, new *T)
+}
+
+// Load returns the current configuration.
+func (r *Reloadable[T]) Load() *T {
+	return r.value.Load()
+}
+
+// Subscribe registers f to be called with the old and new configuration each
+// time a reload changes it. f is called on the goroutine reloading the
+// configuration, so should not block.
+func (r *Reloadable[T]) Subscribe(f func(old, new *T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribers = append(r.subscribers, f)
+}
+
+// set stores c, notifying subscribers if it differs from the current value.
+func (r *Reloadable[T]) set(c *T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.value.Load()
+	if reflect.DeepEqual(old, c) {
+		return
+	}
+
+	r.value.Store(c)
+
+	for _, f := range r.subscribers {
+		f(old, c)
+	}
+}
+
+// ReadReloadableConfig reads configuration into c as App.ReadConfig does, and
+// returns a Reloadable holding it. When the app reloads its configuration, a
+// copy of c as it was before being read, holding any defaults set in code, is
+// read and validated in the same way, and replaces the current value if
+// successful.
+func ReadReloadableConfig[T any](a *App, c *T, name ...string) (*Reloadable[T], error) {
+	initial := *c
+
+	if err := a.ReadConfig(c, name...); err != nil {
+		return nil, err
+	}
+
+	r := &Reloadable[T]{}
+	r.value.Store(c)
+
+	a.onReload(func() error {
+		next := initial
+		if err := a.ReadConfig(&next, name...); err != nil {
+			return err
+		}
+
+		r.set(&next)
+
+		return nil
+	})
+
+	return r, nil
+}
+
+// onReload registers f to be called each time the app reloads its
+// configuration.
+func (a *App) onReload(f func() error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.reloaders = append(a.reloaders, f)
+}
+
+// Reload reads the config file again and reloads every reloadable
+// configuration. Configuration that fails to read or validate keeps its
+// current value, and the problems are returned.
+func (a *App) Reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if err := a.configLayers.reloadFile(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range a.reloaders {
+		if err := f(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reload reloads the app's configuration, logging the outcome.
+func (a *App) reload(trigger string) {
+	if err := a.Reload(); err != nil {
+		a.logger.Error().Err(err).Str("trigger", trigger).Msg("Failed to reload configuration")
+		return
+	}
+
+	a.logger.Info().Str("trigger", trigger).Msg("Reloaded configuration")
+}
+
+// startConfigReload reloads the app's configuration when the process receives
+// SIGHUP, or the config file changes if watching is configured, until ctx is
+// done.
+func (a *App) startConfigReload(ctx context.Context) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(c)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c:
+				a.reload("signal")
+			}
+		}
+	}()
+
+	if a.config.Reload.WatchInterval > 0 && a.configLayers.path != "" {
+		a.watchConfigFile(ctx, a.config.Reload.WatchInterval)
+	}
+}
+
+// watchConfigFile reloads the app's configuration whenever the modification
+// time of the config file changes from its current value, checking every
+// interval until ctx is done.
+func (a *App) watchConfigFile(ctx context.Context, interval time.Duration) {
+	modTime := func() time.Time {
+		info, err := os.Stat(a.configLayers.path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	last := modTime()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if t := modTime(); !t.Equal(last) {
+					last = t
+					a.reload("file")
+				}
+			}
+		}
+	}()
+}
+
+// reloadLogLevel applies a change to the configured log level of the app. The
+// new level also becomes the level restored by SIGUSR2. As with
+// ReadReloadableConfig, a copy of the AppConfig given to NewApp is read, so
+// that values set in code are kept.
+func (a *App) reloadLogLevel() error {
+	c := a.initialConfig
+	if err := a.configLayers.read(&c, a.envPrefix, nil); err != nil {
+		return err
+	}
+
+	lvl, err := appLogLevel(c)
+	if err != nil {
+		return err
+	}
+
+	if a.logLevels.setInitial(lvl) {
+		a.logger.Log().Str("level", lvl.String()).Msg("Changed log level")
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReloadConfig struct {
+	Limit int `validate:"max=100"`
+	Name  string
+}
+
+func writeTestConfigFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func newTestReloadApp(t *testing.T, content string) (*App, string) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfigFile(t, path, content)
+
+	os.Setenv("MY_APP_CONFIG_FILE", path)
+	defer os.Unsetenv("MY_APP_CONFIG_FILE")
+
+	return NewApp(NewAppConfig("MyApp").WithArgs().Build()), path
+}
+
+func TestReadReloadableConfig(t *testing.T) {
+	app, path := newTestReloadApp(t, "limits:\n  limit: 10\n")
+
+	r, err := ReadReloadableConfig(app, &testReloadConfig{Name: "default"}, "Limits")
+	require.NoError(t, err)
+	assert.Equal(t, &testReloadConfig{Limit: 10, Name: "default"}, r.Load())
+
+	var changes [][2]int
+	r.Subscribe(func(old, new *testReloadConfig) {
+		changes = append(changes, [2]int{old.Limit, new.Limit})
+	})
+
+	writeTestConfigFile(t, path, "limits:\n  limit: 20\n")
+	require.NoError(t, app.Reload())
+	assert.Equal(t, &testReloadConfig{Limit: 20, Name: "default"}, r.Load())
+	assert.Equal(t, [][2]int{{10, 20}}, changes)
+	assert.Equal(t, "20", configVar(app.ConfigVars(), "MY_APP_LIMITS_LIMIT").Value)
+
+	require.NoError(t, app.Reload())
+	assert.Len(t, changes, 1, "unchanged configuration notified")
+
+	writeTestConfigFile(t, path, "limits:\n  limit: 200\n")
+	err = app.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MY_APP_LIMITS_LIMIT: must be at most 100")
+	assert.Equal(t, 20, r.Load().Limit)
+	assert.Len(t, changes, 1)
+}
+
+func TestReloadInvalidFile(t *testing.T) {
+	app, path := newTestReloadApp(t, "limits:\n  limit: 10\n")
+	r, err := ReadReloadableConfig(app, &testReloadConfig{}, "Limits")
+	require.NoError(t, err)
+
+	writeTestConfigFile(t, path, "limits: [")
+
+	assert.Error(t, app.Reload())
+	assert.Equal(t, 10, r.Load().Limit)
+}
+
+func TestReloadLogLevel(t *testing.T) {
+	os.Setenv("MY_APP_LOG_LEVEL", "info")
+	defer os.Unsetenv("MY_APP_LOG_LEVEL")
+
+	app := NewApp(NewAppConfig("MyApp").WithArgs().Build())
+	require.Equal(t, zerolog.InfoLevel, app.logLevels.app.Level())
+
+	os.Setenv("MY_APP_LOG_LEVEL", "warn")
+	require.NoError(t, app.Reload())
+
+	assert.Equal(t, zerolog.WarnLevel, app.logLevels.app.Level())
+	assert.Equal(t, zerolog.WarnLevel, app.logLevels.reset())
+}
+
+func TestReloadLogLevelKeepsValuesSetInCode(t *testing.T) {
+	os.Setenv("MY_APP_ENV", "qa")
+	defer os.Unsetenv("MY_APP_ENV")
+
+	config := NewAppConfig("MyApp").WithArgs().Build()
+	config.Log.Level = "error"
+	app := NewApp(config)
+	require.Equal(t, zerolog.ErrorLevel, app.logLevels.app.Level())
+
+	require.NoError(t, app.Reload())
+
+	assert.Equal(t, zerolog.ErrorLevel, app.logLevels.app.Level())
+}
+
+func TestReloadSQSWorkerLogLevel(t *testing.T) {
+	os.Setenv("MY_APP_FOO_RECEIVEQUEUE", "test-queue")
+	defer os.Unsetenv("MY_APP_FOO_RECEIVEQUEUE")
+	os.Setenv("MY_APP_FOO_LOGLEVEL", "error")
+	defer os.Unsetenv("MY_APP_FOO_LOGLEVEL")
+
+	app := NewApp(NewAppConfig("MyApp").WithArgs().Build())
+	app.AddSQS("Foo", NewMsgRouter())
+
+	l, err := app.logLevels.lookup("Foo")
+	require.NoError(t, err)
+	require.Equal(t, zerolog.ErrorLevel, l.Level())
+
+	os.Setenv("MY_APP_FOO_LOGLEVEL", "trace")
+	require.NoError(t, app.Reload())
+	assert.Equal(t, zerolog.TraceLevel, l.Level())
+
+	os.Unsetenv("MY_APP_FOO_LOGLEVEL")
+	require.NoError(t, app.Reload())
+	assert.Equal(t, app.logLevels.app.Level(), l.Level())
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	app, path := newTestReloadApp(t, "limits:\n  limit: 10\n")
+	r, err := ReadReloadableConfig(app, &testReloadConfig{}, "Limits")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.watchConfigFile(ctx, 10*time.Millisecond)
+
+	writeTestConfigFile(t, path, "limits:\n  limit: 30\n")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	assert.Eventually(t, func() bool { return r.Load().Limit == 30 }, time.Second, 10*time.Millisecond)
+}
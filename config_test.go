@@ -1,10 +1,12 @@
 package app
 
 import (
+	"net/url"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReadEnvConfig(t *testing.T) {
@@ -20,6 +22,63 @@ func TestReadEnvConfig(t *testing.T) {
 	assert.Equal(t, "Foo", c.Foo)
 }
 
+type testRawBytes []byte
+
+type testSetter struct {
+	value string
+}
+
+func (s *testSetter) Set(value string) error {
+	s.value = "set:" + value
+	return nil
+}
+
+type testBinaryUnmarshaler struct {
+	value string
+}
+
+func (b *testBinaryUnmarshaler) UnmarshalBinary(data []byte) error {
+	b.value = "binary:" + string(data)
+	return nil
+}
+
+type testEnvconfigTypes struct {
+	Raw    []byte
+	Named  testRawBytes
+	Setter testSetter
+	Binary testBinaryUnmarshaler
+	URL    *url.URL
+}
+
+func TestReadEnvConfigEnvconfigTypes(t *testing.T) {
+	testCases := []struct {
+		name  string
+		env   string
+		value string
+		get   func(c *testEnvconfigTypes) interface{}
+		out   interface{}
+	}{
+		{name: "bytes", env: "MY_APP_RAW", value: "hello", get: func(c *testEnvconfigTypes) interface{} { return c.Raw }, out: []byte("hello")},
+		{name: "bytes with commas", env: "MY_APP_RAW", value: "1,2", get: func(c *testEnvconfigTypes) interface{} { return c.Raw }, out: []byte("1,2")},
+		{name: "named bytes", env: "MY_APP_NAMED", value: "hello", get: func(c *testEnvconfigTypes) interface{} { return []byte(c.Named) }, out: []byte("hello")},
+		{name: "setter", env: "MY_APP_SETTER", value: "foo", get: func(c *testEnvconfigTypes) interface{} { return c.Setter.value }, out: "set:foo"},
+		{name: "binary unmarshaler", env: "MY_APP_BINARY", value: "foo", get: func(c *testEnvconfigTypes) interface{} { return c.Binary.value }, out: "binary:foo"},
+		{name: "url", env: "MY_APP_URL", value: "https://example.com/path", get: func(c *testEnvconfigTypes) interface{} { return c.URL.String() }, out: "https://example.com/path"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(tc.env, tc.value)
+			defer os.Unsetenv(tc.env)
+
+			c := &testEnvconfigTypes{}
+			require.NoError(t, ReadEnvConfig(c, "My", "App"))
+
+			assert.Equal(t, tc.out, tc.get(c))
+		})
+	}
+}
+
 func TestBuildEnvConfigName(t *testing.T) {
 	assert.Equal(t, "MYAPP_FOO_BAR", BuildEnvConfigName("MyApp", "foo", "BAR"))
 }
@@ -35,6 +94,9 @@ func TestValidateAppName(t *testing.T) {
 		{name: "three camel", inName: "FooBarBaz", outValid: true},
 		{name: "adjacent uppercase", inName: "FBar", outValid: true},
 		{name: "only uppercase", inName: "FOOBAR", outValid: true},
+		{name: "digits", inName: "S3Sync", outValid: true},
+		{name: "trailing digits", inName: "Oauth2Proxy", outValid: true},
+		{name: "leading digit", inName: "3Sync", outValid: false},
 		{name: "only lowercase", inName: "foo", outValid: false},
 		{name: "snake", inName: "foo_bar", outValid: false},
 		{name: "kebab", inName: "foo-bar", outValid: false},
@@ -61,6 +123,16 @@ func TestSplitUpperCamelCase(t *testing.T) {
 		{name: "two words", in: "FooBar", out: []string{"Foo", "Bar"}},
 		{name: "lower two words", in: "fooBar", out: []string{"foo", "Bar"}},
 		{name: "three words", in: "FooBarBaz", out: []string{"Foo", "Bar", "Baz"}},
+		{name: "leading acronym", in: "HTTPProxy", out: []string{"HTTP", "Proxy"}},
+		{name: "capitalised acronym", in: "HttpProxy", out: []string{"Http", "Proxy"}},
+		{name: "inner acronym", in: "MyHTTPServer", out: []string{"My", "HTTP", "Server"}},
+		{name: "trailing acronym", in: "ProxyHTTP", out: []string{"Proxy", "HTTP"}},
+		{name: "only uppercase", in: "FOOBAR", out: []string{"FOOBAR"}},
+		{name: "single letter word", in: "FBar", out: []string{"F", "Bar"}},
+		{name: "digit in word", in: "S3Sync", out: []string{"S3", "Sync"}},
+		{name: "trailing digit", in: "Oauth2Proxy", out: []string{"Oauth2", "Proxy"}},
+		{name: "acronym with digit", in: "HTTP2Server", out: []string{"HTTP2", "Server"}},
+		{name: "digits at end", in: "Route53", out: []string{"Route53"}},
 	}
 
 	for _, tc := range testCases {
@@ -69,3 +141,34 @@ func TestSplitUpperCamelCase(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEnvPrefix(t *testing.T) {
+	assert.True(t, validateEnvPrefix("MY_APP"))
+	assert.True(t, validateEnvPrefix("S3_SYNC"))
+	assert.False(t, validateEnvPrefix("my_app"))
+	assert.False(t, validateEnvPrefix("MY-APP"))
+	assert.False(t, validateEnvPrefix("_MY_APP"))
+	assert.False(t, validateEnvPrefix(""))
+}
+
+func TestEnvPrefix(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    AppConfig
+		outPrefix string
+		outLegacy string
+	}{
+		{name: "camel case", config: AppConfig{Name: "MyApp"}, outPrefix: "MY_APP", outLegacy: "MY_APP"},
+		{name: "leading acronym", config: AppConfig{Name: "HTTPProxy"}, outPrefix: "HTTP_PROXY", outLegacy: "HTTPPROXY"},
+		{name: "capitalised acronym", config: AppConfig{Name: "HttpProxy"}, outPrefix: "HTTP_PROXY", outLegacy: "HTTP_PROXY"},
+		{name: "digits", config: AppConfig{Name: "S3Sync"}, outPrefix: "S3_SYNC", outLegacy: ""},
+		{name: "override", config: AppConfig{Name: "HTTPProxy"}.WithEnvPrefix("HTTPPROXY"), outPrefix: "HTTPPROXY", outLegacy: "HTTPPROXY"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.outPrefix, tc.config.envPrefix())
+			assert.Equal(t, tc.outLegacy, legacyEnvPrefix(tc.config.Name))
+		})
+	}
+}
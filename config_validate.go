@@ -0,0 +1,206 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigError reports every problem found reading configuration, each naming
+// the environment variable of the field at fault.
+type ConfigError struct {
+	Problems []error
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return e.Problems
+}
+
+// validate reads every recorded struct again into a copy of its current value,
+// without recording it, and reports every problem found in a ConfigError.
+func (l *configLayers) validate() error {
+	l.mu.Lock()
+	specs := append([]configSpec{}, l.specs...)
+	l.mu.Unlock()
+
+	var problems []error
+
+	for _, s := range specs {
+		v := reflect.ValueOf(s.spec).Elem()
+		c := reflect.New(v.Type())
+		c.Elem().Set(v)
+
+		if err := l.read(c.Interface(), s.envPrefix, s.keyPath); err != nil {
+			var cerr *ConfigError
+			if errors.As(err, &cerr) {
+				problems = append(problems, cerr.Problems...)
+			} else {
+				problems = append(problems, err)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+
+	return nil
+}
+
+// fieldError is a problem with the configuration field named by key.
+type fieldError struct {
+	key string
+	err error
+}
+
+func (e *fieldError) Error() string {
+	return e.key + ": " + e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// configValidator is implemented by configuration structs with validation
+// beyond that of struct tags, e.g. rules involving several fields. Validate
+// is called once the struct's fields have been read without problems.
+type configValidator interface {
+	Validate() error
+}
+
+// validateConfigField checks v against the required tag and the comma
+// separated rules of the validate tag of its field, returning a message for
+// each rule broken. A required field must have been set by a layer, as
+// reported by set, but may be set to a zero value such as 0 or false. Other
+// rules are only checked for non-zero values. The rules are:
+//
+//	min=N, max=N  bounds of numbers, durations, or the length of strings,
+//	              slices and maps
+//	oneof=a b c   allowed values
+//	url           an absolute URL
+//	duration      a duration string, e.g. 1m30s
+//	hostport      a host:port address
+func validateConfigField(v reflect.Value, sf reflect.StructField, set bool) []string {
+	if !set && sf.Tag.Get("required") == "true" {
+		return []string{"required value missing"}
+	}
+
+	if isZeroConfigValue(v) {
+		return nil
+	}
+
+	var problems []string
+
+	for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+		if rule == "" {
+			continue
+		}
+
+		name, arg, _ := strings.Cut(rule, "=")
+
+		var err error
+		switch name {
+		case "min":
+			err = checkConfigBound(v, arg, func(value, bound float64) bool { return value >= bound }, "at least")
+		case "max":
+			err = checkConfigBound(v, arg, func(value, bound float64) bool { return value <= bound }, "at most")
+		case "oneof":
+			err = checkConfigOneOf(v, strings.Fields(arg))
+		case "url":
+			u, perr := url.Parse(fmt.Sprint(v.Interface()))
+			if perr != nil || u.Scheme == "" || u.Host == "" {
+				err = fmt.Errorf("must be an absolute URL")
+			}
+		case "duration":
+			if _, perr := time.ParseDuration(v.String()); perr != nil {
+				err = fmt.Errorf("must be a duration, e.g. 1m30s")
+			}
+		case "hostport":
+			if _, _, perr := net.SplitHostPort(v.String()); perr != nil {
+				err = fmt.Errorf("must be a host:port address")
+			}
+		default:
+			err = fmt.Errorf("unknown validation rule %q", name)
+		}
+
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
+
+func isZeroConfigValue(v reflect.Value) bool {
+	if v.Type() == secretType {
+		return v.Interface().(Secret).Value() == ""
+	}
+
+	return v.IsZero()
+}
+
+// checkConfigBound checks the value, or length, of v against bound using ok.
+func checkConfigBound(v reflect.Value, bound string, ok func(value, bound float64) bool, desc string) error {
+	var value, b float64
+	var err error
+	subject := "must"
+
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		value = float64(v.Len())
+		b, err = strconv.ParseFloat(bound, 64)
+		subject = "length must"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			var d time.Duration
+			d, err = time.ParseDuration(bound)
+			value, b = float64(v.Int()), float64(d)
+		} else {
+			value = float64(v.Int())
+			b, err = strconv.ParseFloat(bound, 64)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = float64(v.Uint())
+		b, err = strconv.ParseFloat(bound, 64)
+	case reflect.Float32, reflect.Float64:
+		value = v.Float()
+		b, err = strconv.ParseFloat(bound, 64)
+	default:
+		return fmt.Errorf("cannot check bounds of %s", v.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid bound %q", bound)
+	}
+	if !ok(value, b) {
+		return fmt.Errorf("%s be %s %s", subject, desc, bound)
+	}
+
+	return nil
+}
+
+func checkConfigOneOf(v reflect.Value, allowed []string) error {
+	value := fmt.Sprint(v.Interface())
+
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+}
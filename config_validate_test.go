@@ -0,0 +1,126 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfigField(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value interface{}
+		unset bool
+		tag   reflect.StructTag
+		out   []string
+	}{
+		{name: "required missing", value: "", unset: true, tag: `required:"true"`, out: []string{"required value missing"}},
+		{name: "required missing with value in code", value: "foo", unset: true, tag: `required:"true"`, out: []string{"required value missing"}},
+		{name: "required set", value: "foo", tag: `required:"true"`},
+		{name: "required set empty", value: "", tag: `required:"true"`},
+		{name: "required set to zero", value: 0, tag: `required:"true"`},
+		{name: "required set to false", value: false, tag: `required:"true"`},
+		{name: "required missing secret", value: Secret{}, unset: true, tag: `required:"true"`, out: []string{"required value missing"}},
+		{name: "required set secret", value: NewSecret("foo"), tag: `required:"true"`},
+		{name: "rules skipped when zero", value: 0, tag: `validate:"min=1"`},
+		{name: "min", value: 0.5, tag: `validate:"min=1"`, out: []string{"must be at least 1"}},
+		{name: "max", value: 70000, tag: `validate:"min=1,max=65535"`, out: []string{"must be at most 65535"}},
+		{name: "in range", value: 8080, tag: `validate:"min=1,max=65535"`},
+		{name: "uint max", value: uint32(11), tag: `validate:"max=10"`, out: []string{"must be at most 10"}},
+		{name: "duration bound", value: time.Second, tag: `validate:"min=1m"`, out: []string{"must be at least 1m"}},
+		{name: "length bound", value: "ab", tag: `validate:"min=3"`, out: []string{"length must be at least 3"}},
+		{name: "invalid bound", value: 1, tag: `validate:"min=x"`, out: []string{`invalid bound "x"`}},
+		{name: "oneof", value: "xml", tag: `validate:"oneof=json console"`, out: []string{"must be one of json, console"}},
+		{name: "oneof allowed", value: "json", tag: `validate:"oneof=json console"`},
+		{name: "url", value: "localhost:9091", tag: `validate:"url"`, out: []string{"must be an absolute URL"}},
+		{name: "url valid", value: "http://localhost:9091", tag: `validate:"url"`},
+		{name: "duration", value: "5", tag: `validate:"duration"`, out: []string{"must be a duration, e.g. 1m30s"}},
+		{name: "duration valid", value: "5s", tag: `validate:"duration"`},
+		{name: "hostport", value: "localhost", tag: `validate:"hostport"`, out: []string{"must be a host:port address"}},
+		{name: "hostport valid", value: "localhost:8125", tag: `validate:"hostport"`},
+		{name: "unknown rule", value: "foo", tag: `validate:"email"`, out: []string{`unknown validation rule "email"`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.ValueOf(tc.value)
+			sf := reflect.StructField{Name: "Field", Type: v.Type(), Tag: tc.tag}
+
+			assert.Equal(t, tc.out, validateConfigField(v, sf, !tc.unset))
+		})
+	}
+}
+
+type testValidatedConfig struct {
+	Orders struct {
+		ReceiveQueue string `required:"true" split_words:"true"`
+		MaxRetries   int    `validate:"max=10"`
+	}
+	Port int    `validate:"min=1,max=65535"`
+	Mode string `validate:"oneof=fast slow"`
+}
+
+func TestConfigLayersAggregatesProblems(t *testing.T) {
+	env := map[string]string{
+		"MY_APP_ORDERS_MAXRETRIES": "20",
+		"MY_APP_PORT":              "70000",
+		"MY_APP_MODE":              "medium",
+	}
+
+	err := testConfigLayers(nil, env).load(&testValidatedConfig{}, "MY_APP", nil)
+
+	var configErr *ConfigError
+	require.True(t, errors.As(err, &configErr))
+	assert.Len(t, configErr.Problems, 4)
+	assert.EqualError(t, err, "invalid configuration: "+
+		"MY_APP_ORDERS_RECEIVE_QUEUE: required value missing; "+
+		"MY_APP_ORDERS_MAXRETRIES: must be at most 10; "+
+		"MY_APP_PORT: must be at most 65535; "+
+		"MY_APP_MODE: must be one of fast, slow")
+}
+
+type testCustomValidatedConfig struct {
+	Min int
+	Max int
+}
+
+func (c *testCustomValidatedConfig) Validate() error {
+	if c.Min > c.Max {
+		return errors.New("min must not exceed max")
+	}
+	return nil
+}
+
+func TestConfigLayersCustomValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		env    map[string]string
+		outErr string
+	}{
+		{name: "valid", env: map[string]string{"MY_APP_MIN": "1", "MY_APP_MAX": "2"}},
+		{name: "invalid", env: map[string]string{"MY_APP_MIN": "3", "MY_APP_MAX": "2"}, outErr: "invalid configuration: MY_APP: min must not exceed max"},
+		{name: "skipped when fields invalid", env: map[string]string{"MY_APP_MIN": "x", "MY_APP_MAX": "2"}, outErr: "invalid configuration: MY_APP_MIN: invalid value: strconv.ParseInt: parsing \"x\": invalid syntax"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testConfigLayers(nil, tc.env).load(&testCustomValidatedConfig{}, "MY_APP", nil)
+
+			if tc.outErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.outErr)
+			}
+		})
+	}
+}
+
+func TestLogConfigValidate(t *testing.T) {
+	assert.NoError(t, (&LogConfig{}).Validate())
+	assert.NoError(t, (&LogConfig{Level: "WARN"}).Validate())
+	assert.EqualError(t, (&LogConfig{Level: "loud"}).Validate(), `unknown log level "loud"`)
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// CorrelationIDHeader is the HTTP header carrying the correlation ID of a request.
+	CorrelationIDHeader = "X-Correlation-ID"
+	// CorrelationIDAttribute is the SQS message attribute carrying the correlation ID of a message.
+	CorrelationIDAttribute = "correlationId"
+
+	// maxCorrelationIDLength is the length of the longest correlation ID
+	// accepted from a request or message.
+	maxCorrelationIDLength = 128
+)
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty
+// string if there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// NewCorrelationID generates a new random correlation ID.
+func NewCorrelationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validCorrelationID reports whether id, received from a client or another
+// service, is safe to log and propagate. It must be no longer than
+// maxCorrelationIDLength and contain only letters, digits and the characters
+// . _ : and -.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// correlationHandler wraps h to take the correlation ID of each request from
+// its CorrelationIDHeader, or generate a new one if it has none or it is not
+// valid, and make it available through the request context, the context
+// logger and the response header.
+func correlationHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(CorrelationIDHeader)
+		if !validCorrelationID(id) {
+			id = NewCorrelationID()
+		}
+
+		w.Header().Set(CorrelationIDHeader, id)
+
+		ctx := WithCorrelationID(r.Context(), id)
+		logger := zerolog.Ctx(ctx).With().Str("correlationId", id).Logger()
+		ctx = logger.WithContext(ctx)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setCorrelationIDAttribute adds the correlation ID carried by ctx to attributes.
+func setCorrelationIDAttribute(ctx context.Context, attributes map[string]*sqs.MessageAttributeValue) {
+	if id := CorrelationID(ctx); id != "" {
+		attributes[CorrelationIDAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(id)}
+	}
+}
+
+// correlationIDAttribute returns the correlation ID of msg, or generates a
+// new one if the message has none or it is not valid.
+func correlationIDAttribute(msg *sqs.Message) string {
+	if attrib, ok := msg.MessageAttributes[CorrelationIDAttribute]; ok && attrib.StringValue != nil && validCorrelationID(*attrib.StringValue) {
+		return *attrib.StringValue
+	}
+
+	return NewCorrelationID()
+}
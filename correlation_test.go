@@ -0,0 +1,150 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationID(t *testing.T) {
+	assert.Equal(t, "", CorrelationID(context.Background()))
+	assert.Equal(t, "foo", CorrelationID(WithCorrelationID(context.Background(), "foo")))
+}
+
+func TestNewCorrelationID(t *testing.T) {
+	id := NewCorrelationID()
+
+	assert.Len(t, id, 32)
+	assert.NotEqual(t, id, NewCorrelationID())
+}
+
+func TestValidCorrelationID(t *testing.T) {
+	testCases := []struct {
+		name string
+		id   string
+		out  bool
+	}{
+		{name: "hex", id: NewCorrelationID(), out: true},
+		{name: "equals sign", id: "Root=1-abc", out: false},
+		{name: "allowed punctuation", id: "abc_def.ghi:jkl-1", out: true},
+		{name: "empty", id: "", out: false},
+		{name: "max length", id: strings.Repeat("a", maxCorrelationIDLength), out: true},
+		{name: "too long", id: strings.Repeat("a", maxCorrelationIDLength+1), out: false},
+		{name: "newline", id: "abc\ndef", out: false},
+		{name: "space", id: "abc def", out: false},
+		{name: "non-ascii", id: "abcé", out: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, validCorrelationID(tc.id))
+		})
+	}
+}
+
+func TestCorrelationHandler(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inHeader     string
+		outGenerated bool
+	}{
+		{name: "from header", inHeader: "test-id"},
+		{name: "generated", outGenerated: true},
+		{name: "too long", inHeader: strings.Repeat("a", maxCorrelationIDLength+1), outGenerated: true},
+		{name: "invalid characters", inHeader: `test"id`, outGenerated: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			var id string
+
+			handler := correlationHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id = CorrelationID(r.Context())
+				zerolog.Ctx(r.Context()).Info().Msg("handling")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.inHeader != "" {
+				req.Header.Set(CorrelationIDHeader, tc.inHeader)
+			}
+			logger := zerolog.New(buf)
+			req = req.WithContext(logger.WithContext(req.Context()))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			require.NotEmpty(t, id)
+			if tc.outGenerated {
+				assert.NotEqual(t, tc.inHeader, id)
+				assert.Len(t, id, 32)
+			} else {
+				assert.Equal(t, tc.inHeader, id)
+			}
+			assert.Equal(t, id, rec.Header().Get(CorrelationIDHeader))
+			assert.Contains(t, buf.String(), `"correlationId":"`+id+`"`)
+		})
+	}
+}
+
+func TestSendAddsCorrelationID(t *testing.T) {
+	mockSvc := &mockSQSClient{}
+	queue := NewQueue(NewQueueConfig("msgType"), mockSvc)
+
+	err := queue.Send(WithCorrelationID(context.Background(), "test-id"), "test-body", "test-queue")
+
+	require.NoError(t, err)
+	require.Contains(t, mockSvc.sendInput.MessageAttributes, CorrelationIDAttribute)
+	assert.Equal(t, "test-id", *mockSvc.sendInput.MessageAttributes[CorrelationIDAttribute].StringValue)
+}
+
+func TestNewMessageContextCorrelationID(t *testing.T) {
+	buf := &bytes.Buffer{}
+	msg := &sqs.Message{}
+	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{CorrelationIDAttribute: {StringValue: aws.String("test-id")}})
+
+	msgCtx := newMessageContext(context.Background(), msg, "msgType", zerolog.New(buf))
+	msgCtx.Logger.Info().Msg("test")
+
+	assert.Equal(t, "test-id", msgCtx.CorrelationID)
+	assert.Equal(t, "test-id", CorrelationID(msgCtx.Ctx))
+	assert.Contains(t, buf.String(), `"correlationId":"test-id"`)
+}
+
+func TestNewMessageContextGeneratesCorrelationID(t *testing.T) {
+	msgCtx := newMessageContext(context.Background(), &sqs.Message{}, "msgType", zerolog.Nop())
+
+	assert.NotEmpty(t, msgCtx.CorrelationID)
+	assert.Equal(t, msgCtx.CorrelationID, CorrelationID(msgCtx.Ctx))
+}
+
+func TestNewMessageContextReplacesInvalidCorrelationID(t *testing.T) {
+	msg := &sqs.Message{}
+	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{CorrelationIDAttribute: {StringValue: aws.String("test id")}})
+
+	msgCtx := newMessageContext(context.Background(), msg, "msgType", zerolog.Nop())
+
+	assert.Len(t, msgCtx.CorrelationID, 32)
+	assert.Equal(t, msgCtx.CorrelationID, CorrelationID(msgCtx.Ctx))
+}
+
+func TestFollowUpMessageCarriesCorrelationID(t *testing.T) {
+	msg := &sqs.Message{}
+	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{CorrelationIDAttribute: {StringValue: aws.String("test-id")}})
+	msgCtx := newMessageContext(context.Background(), msg, "msgType", zerolog.Nop())
+
+	mockSvc := &mockSQSClient{}
+	queue := NewQueue(NewQueueConfig("msgType"), mockSvc)
+	require.NoError(t, queue.Send(msgCtx.Ctx, "follow-up", "other-queue"))
+
+	assert.Equal(t, "test-id", *mockSvc.sendInput.MessageAttributes[CorrelationIDAttribute].StringValue)
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for the value of a flag evaluation, recorded in the reason label of
+// the feature_flag_evaluations_total metric.
+const (
+	flagReasonDefault = "default"
+	flagReasonStatic  = "static"
+	flagReasonRule    = "rule"
+	flagReasonRollout = "rollout"
+	flagReasonError   = "error"
+)
+
+// FlagProvider supplies the definitions of feature flags by name.
+type FlagProvider interface {
+	Flag(name string) (FlagDefinition, bool)
+}
+
+// FlagDefinition defines the value of a feature flag. The value of the first
+// rule matching the context is used, or else Value. When Rollout is set, Value
+// applies only to that percentage of contexts, chosen by their key, and the
+// remainder get the default given when evaluating the flag.
+type FlagDefinition struct {
+	Value   string
+	Rollout *float64
+	Rules   []FlagRule
+}
+
+// FlagRule gives a feature flag Value for contexts whose Attribute has one of
+// Values.
+type FlagRule struct {
+	Attribute string
+	Values    []string
+	Value     string
+}
+
+// FlagContext is what a feature flag is evaluated against. Key identifies the
+// subject, e.g. a user ID, and decides which subjects are in a percentage
+// rollout. Attributes are matched by rules, e.g. msgType.
+type FlagContext struct {
+	Key        string
+	Attributes map[string]string
+}
+
+// Flags evaluates feature flags defined by a FlagProvider, counting each
+// evaluation in the feature_flag_evaluations_total metric.
+type Flags struct {
+	provider    FlagProvider
+	evaluations *prometheus.CounterVec
+}
+
+func newFlags(provider FlagProvider, m *Metrics) *Flags {
+	return &Flags{
+		provider:    provider,
+		evaluations: m.NewCounterVec("feature_flag_evaluations_total", "The total number of feature flag evaluations", []string{"flag", "value", "reason"}),
+	}
+}
+
+// Bool returns the value of the boolean flag name for fctx, or def if the flag
+// is not defined, not rolled out to fctx or not a boolean.
+func (f *Flags) Bool(name string, fctx FlagContext, def bool) bool {
+	value, reason, ok := f.evaluate(name, fctx)
+
+	b := def
+	if ok {
+		var err error
+		if b, err = strconv.ParseBool(value); err != nil {
+			b, reason = def, flagReasonError
+		}
+	}
+
+	f.evaluations.WithLabelValues(name, strconv.FormatBool(b), reason).Inc()
+
+	return b
+}
+
+// String returns the value of the flag name for fctx, or def if the flag is
+// not defined or not rolled out to fctx.
+func (f *Flags) String(name string, fctx FlagContext, def string) string {
+	value, reason, ok := f.evaluate(name, fctx)
+	if !ok {
+		value = def
+	}
+
+	f.evaluations.WithLabelValues(name, value, reason).Inc()
+
+	return value
+}
+
+// evaluate returns the value of the flag name for fctx and the reason for it,
+// or false if the default should be used.
+func (f *Flags) evaluate(name string, fctx FlagContext) (string, string, bool) {
+	def, ok := f.provider.Flag(name)
+	if !ok {
+		return "", flagReasonDefault, false
+	}
+
+	for _, r := range def.Rules {
+		attr, ok := fctx.Attributes[r.Attribute]
+		if !ok {
+			continue
+		}
+		for _, v := range r.Values {
+			if v == attr {
+				return r.Value, flagReasonRule, true
+			}
+		}
+	}
+
+	if def.Rollout != nil {
+		return def.Value, flagReasonRollout, fctx.Key != "" && rolloutBucket(name, fctx.Key) < *def.Rollout
+	}
+
+	return def.Value, flagReasonStatic, true
+}
+
+// rolloutBucket places key in a bucket from 0 up to 100 for the flag name, so
+// that each key consistently gets the same value of a flag while a rollout
+// percentage is unchanged, and increasing it only adds keys.
+func rolloutBucket(name string, key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + key))
+
+	return float64(h.Sum32()%10000) / 100
+}
+
+// FlagContext returns the context for evaluating feature flags for msg, keyed
+// by its correlation ID so that related messages get the same value, with the
+// msgType and queue attributes.
+func (m *MsgContext) FlagContext() FlagContext {
+	attrs := map[string]string{"queue": m.queue}
+	if m.MsgType != nil {
+		attrs["msgType"] = *m.MsgType
+	}
+
+	return FlagContext{Key: m.CorrelationID, Attributes: attrs}
+}
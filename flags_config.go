@@ -0,0 +1,173 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// configFlagProvider is the default FlagProvider, defining feature flags in the
+// flags section of the config file, environment variables and flags. Flags are
+// matched by name ignoring case, underscores and dashes, as configuration keys
+// are.
+//
+// In the config file a flag is either a value, or a value with a percentage
+// rollout and rules, e.g.
+//
+//	flags:
+//	  newCheckout: true
+//	  search:
+//	    value: true
+//	    rollout: 25
+//	    rules:
+//	      - attribute: msgType
+//	        values: [order]
+//	        value: false
+//
+// An environment variable such as MY_APP_FLAGS_NEW_CHECKOUT=false or a flag
+// such as --flags.newCheckout=false gives a flag a fixed value, in place of its
+// definition in the config file.
+type configFlagProvider struct {
+	layers    *configLayers
+	envPrefix string
+	environ   func() []string
+	flags     atomic.Pointer[map[string]FlagDefinition]
+}
+
+func newConfigFlagProvider(l *configLayers, envPrefix string) (*configFlagProvider, error) {
+	p := &configFlagProvider{layers: l, envPrefix: envPrefix, environ: os.Environ}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Flag returns the definition of the flag name.
+func (p *configFlagProvider) Flag(name string) (FlagDefinition, bool) {
+	def, ok := (*p.flags.Load())[configKey(name)]
+	return def, ok
+}
+
+// reload reads the flag definitions again, keeping the current definitions if
+// any are invalid.
+func (p *configFlagProvider) reload() error {
+	flags := make(map[string]FlagDefinition)
+
+	if raw, ok := lookupConfigFile(p.layers.file, []string{"flags"}); ok {
+		section, ok := raw.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid flags in config file: expected a map")
+		}
+		for name, v := range section {
+			def, err := parseFlagDefinition(v)
+			if err != nil {
+				return fmt.Errorf("invalid definition of flag %s in config file: %w", name, err)
+			}
+			flags[configKey(name)] = def
+		}
+	}
+
+	prefix := p.envPrefix + "_FLAGS_"
+	for _, kv := range p.environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(k, prefix); ok && name != "" {
+			flags[configKey(name)] = FlagDefinition{Value: v}
+		}
+	}
+
+	for k, v := range p.layers.flags {
+		if name, ok := strings.CutPrefix(k, "flags."); ok {
+			flags[name] = FlagDefinition{Value: v}
+		}
+	}
+
+	p.flags.Store(&flags)
+
+	return nil
+}
+
+// parseFlagDefinition parses the definition of a flag in the config file,
+// either a scalar value or a map with value, rollout and rules keys.
+func parseFlagDefinition(raw interface{}) (FlagDefinition, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		if _, ok := raw.([]interface{}); ok {
+			return FlagDefinition{}, errors.New("expected a value or a map")
+		}
+		return FlagDefinition{Value: configScalarString(raw)}, nil
+	}
+
+	var def FlagDefinition
+
+	for k, v := range m {
+		switch configKey(k) {
+		case "value":
+			def.Value = configScalarString(v)
+		case "rollout":
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(configScalarString(v), "%"), 64)
+			if err != nil {
+				return FlagDefinition{}, fmt.Errorf("invalid rollout: %w", err)
+			}
+			if pct < 0 || pct > 100 {
+				return FlagDefinition{}, errors.New("rollout must be between 0 and 100")
+			}
+			def.Rollout = &pct
+		case "rules":
+			rules, ok := v.([]interface{})
+			if !ok {
+				return FlagDefinition{}, errors.New("rules must be a list")
+			}
+			for i, r := range rules {
+				rule, err := parseFlagRule(r)
+				if err != nil {
+					return FlagDefinition{}, fmt.Errorf("invalid rule %d: %w", i+1, err)
+				}
+				def.Rules = append(def.Rules, rule)
+			}
+		default:
+			return FlagDefinition{}, fmt.Errorf("unknown key %q", k)
+		}
+	}
+
+	return def, nil
+}
+
+// parseFlagRule parses a rule of a flag in the config file, a map with
+// attribute, values and value keys. Values may be a single value.
+func parseFlagRule(raw interface{}) (FlagRule, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return FlagRule{}, errors.New("expected a map")
+	}
+
+	var rule FlagRule
+
+	for k, v := range m {
+		switch configKey(k) {
+		case "attribute":
+			rule.Attribute = configScalarString(v)
+		case "values":
+			if values, ok := v.([]interface{}); ok {
+				for _, e := range values {
+					rule.Values = append(rule.Values, configScalarString(e))
+				}
+			} else {
+				rule.Values = []string{configScalarString(v)}
+			}
+		case "value":
+			rule.Value = configScalarString(v)
+		default:
+			return FlagRule{}, fmt.Errorf("unknown key %q", k)
+		}
+	}
+
+	if rule.Attribute == "" {
+		return FlagRule{}, errors.New("attribute missing")
+	}
+
+	return rule, nil
+}
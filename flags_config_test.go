@@ -0,0 +1,109 @@
+package app
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFlagDefinition(t *testing.T) {
+	pct := 25.0
+
+	testCases := []struct {
+		name   string
+		raw    interface{}
+		out    FlagDefinition
+		outErr string
+	}{
+		{name: "bool", raw: true, out: FlagDefinition{Value: "true"}},
+		{name: "string", raw: "blue", out: FlagDefinition{Value: "blue"}},
+		{name: "rollout", raw: map[string]interface{}{"value": true, "rollout": "25%"}, out: FlagDefinition{Value: "true", Rollout: &pct}},
+		{name: "rules", raw: map[string]interface{}{"value": "a", "rules": []interface{}{
+			map[string]interface{}{"attribute": "msgType", "values": []interface{}{"x", "y"}, "value": "b"},
+			map[string]interface{}{"attribute": "queue", "values": "q", "value": "c"},
+		}}, out: FlagDefinition{Value: "a", Rules: []FlagRule{{Attribute: "msgType", Values: []string{"x", "y"}, Value: "b"}, {Attribute: "queue", Values: []string{"q"}, Value: "c"}}}},
+		{name: "list", raw: []interface{}{true}, outErr: "expected a value or a map"},
+		{name: "rollout out of range", raw: map[string]interface{}{"rollout": 150}, outErr: "rollout must be between 0 and 100"},
+		{name: "invalid rollout", raw: map[string]interface{}{"rollout": "half"}, outErr: "invalid rollout"},
+		{name: "unknown key", raw: map[string]interface{}{"enabled": true}, outErr: `unknown key "enabled"`},
+		{name: "rule without attribute", raw: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"value": "b"}}}, outErr: "invalid rule 1: attribute missing"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def, err := parseFlagDefinition(tc.raw)
+			if tc.outErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.outErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, def)
+		})
+	}
+}
+
+func TestConfigFlagProvider(t *testing.T) {
+	l := &configLayers{
+		file: map[string]interface{}{"flags": map[string]interface{}{
+			"newCheckout": true,
+			"search":      "v1",
+			"color":       "red",
+		}},
+		flags: map[string]string{"flags.color": "green", "log.level": "info"},
+	}
+
+	p, err := newConfigFlagProvider(l, "MY_APP")
+	require.NoError(t, err)
+	p.environ = func() []string {
+		return []string{"MY_APP_FLAGS_SEARCH=v2", "MY_APP_FLAGS_COLOR=blue", "OTHER_FLAGS_X=1"}
+	}
+	require.NoError(t, p.reload())
+
+	testCases := []struct {
+		flag  string
+		out   string
+		outOK bool
+	}{
+		{flag: "new-checkout", out: "true", outOK: true},
+		{flag: "NEW_CHECKOUT", out: "true", outOK: true},
+		{flag: "search", out: "v2", outOK: true},
+		{flag: "color", out: "green", outOK: true},
+		{flag: "x"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.flag, func(t *testing.T) {
+			def, ok := p.Flag(tc.flag)
+			assert.Equal(t, tc.outOK, ok)
+			assert.Equal(t, tc.out, def.Value)
+		})
+	}
+
+	l.file = map[string]interface{}{"flags": map[string]interface{}{"search": map[string]interface{}{"rollout": "x"}}}
+	assert.Error(t, p.reload())
+	_, ok := p.Flag("newCheckout")
+	assert.True(t, ok, "definitions replaced by invalid reload")
+}
+
+func TestAppFlagsReload(t *testing.T) {
+	app, path := newTestReloadApp(t, "flags:\n  beta: false\n")
+	require.False(t, app.Flags.Bool("beta", FlagContext{}, true))
+
+	writeTestConfigFile(t, path, "flags:\n  beta: true\n")
+	require.NoError(t, app.Reload())
+	assert.True(t, app.Flags.Bool("beta", FlagContext{}, false))
+
+	os.Setenv("MY_APP_FLAGS_BETA", "false")
+	defer os.Unsetenv("MY_APP_FLAGS_BETA")
+	require.NoError(t, app.Reload())
+	assert.False(t, app.Flags.Bool("beta", FlagContext{}, true))
+}
+
+func TestAppWithFlagProvider(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").WithArgs().WithFlagProvider(testFlagProvider{"beta": {Value: "true"}}).Build())
+
+	assert.True(t, app.Flags.Bool("beta", FlagContext{}, false))
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testFlagProvider map[string]FlagDefinition
+
+func (p testFlagProvider) Flag(name string) (FlagDefinition, bool) {
+	def, ok := p[name]
+	return def, ok
+}
+
+func newTestFlags(p testFlagProvider) *Flags {
+	return newFlags(p, NewMetrics(PrometheusConfig{}))
+}
+
+func TestFlagsBool(t *testing.T) {
+	flags := newTestFlags(testFlagProvider{
+		"on":      {Value: "true"},
+		"off":     {Value: "false"},
+		"invalid": {Value: "maybe"},
+		"rule":    {Value: "false", Rules: []FlagRule{{Attribute: "msgType", Values: []string{"a", "b"}, Value: "true"}}},
+	})
+
+	testCases := []struct {
+		name      string
+		flag      string
+		fctx      FlagContext
+		def       bool
+		out       bool
+		outReason string
+	}{
+		{name: "on", flag: "on", out: true, outReason: flagReasonStatic},
+		{name: "off", flag: "off", def: true, out: false, outReason: flagReasonStatic},
+		{name: "undefined", flag: "missing", def: true, out: true, outReason: flagReasonDefault},
+		{name: "invalid", flag: "invalid", def: true, out: true, outReason: flagReasonError},
+		{name: "rule matched", flag: "rule", fctx: FlagContext{Attributes: map[string]string{"msgType": "b"}}, out: true, outReason: flagReasonRule},
+		{name: "rule not matched", flag: "rule", fctx: FlagContext{Attributes: map[string]string{"msgType": "c"}}, def: true, out: false, outReason: flagReasonStatic},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, flags.Bool(tc.flag, tc.fctx, tc.def))
+
+			counter := flags.evaluations.With(prometheus.Labels{"flag": tc.flag, "value": strconv.FormatBool(tc.out), "reason": tc.outReason})
+			assert.Equal(t, float64(1), testutil.ToFloat64(counter))
+		})
+	}
+}
+
+func TestFlagsString(t *testing.T) {
+	flags := newTestFlags(testFlagProvider{"color": {Value: "blue"}})
+
+	assert.Equal(t, "blue", flags.String("color", FlagContext{}, "red"))
+	assert.Equal(t, "red", flags.String("size", FlagContext{}, "red"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(flags.evaluations.With(prometheus.Labels{"flag": "size", "value": "red", "reason": flagReasonDefault})))
+}
+
+func TestFlagsRollout(t *testing.T) {
+	pct := 30.0
+	flags := newTestFlags(testFlagProvider{"beta": {Value: "true", Rollout: &pct}})
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		fctx := FlagContext{Key: "user-" + strconv.Itoa(i)}
+		enabled := flags.Bool("beta", fctx, false)
+		assert.Equal(t, enabled, flags.Bool("beta", fctx, false), "evaluation not consistent")
+		if enabled {
+			on++
+		}
+	}
+	assert.InDelta(t, 300, on, 60)
+
+	assert.False(t, flags.Bool("beta", FlagContext{}, false), "rolled out without a key")
+
+	pct = 100
+	assert.True(t, flags.Bool("beta", FlagContext{Key: "user-1"}, false))
+	pct = 0
+	assert.False(t, flags.Bool("beta", FlagContext{Key: "user-1"}, false))
+}
+
+func TestMsgContextFlagContext(t *testing.T) {
+	msgType := "order"
+	msg := &MsgContext{MsgType: &msgType, CorrelationID: "abc", queue: "orders"}
+
+	assert.Equal(t, FlagContext{Key: "abc", Attributes: map[string]string{"msgType": "order", "queue": "orders"}}, msg.FlagContext())
+}
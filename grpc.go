@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type grpcState struct {
+	listenState
+	grpcServer *grpc.Server
+}
+
+// GRPCServer is a handle to a gRPC server added to the app.
+type GRPCServer struct {
+	state *grpcState
+}
+
+// Addr returns the address the server is bound to, or nil if the
+// server is not yet listening.
+func (s *GRPCServer) Addr() net.Addr {
+	return s.state.addr()
+}
+
+// Listening returns a channel that is closed once the server is bound
+// to its address.
+func (s *GRPCServer) Listening() <-chan struct{} {
+	return s.state.listening
+}
+
+type grpcMetrics struct {
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewGRPCServer creates a gRPC server with interceptors for logging and
+// Prometheus metrics, and with the standard gRPC health service reporting
+// the app's readiness. Services should be registered on the returned server
+// before it is added with AddGRPC.
+func (a *App) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	m := a.getGRPCMetrics()
+
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(a.unaryServerInterceptor(m)),
+		grpc.ChainStreamInterceptor(a.streamServerInterceptor(m)),
+	)
+
+	s := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(s, a.newGRPCHealthServer())
+
+	return s
+}
+
+// AddGRPC adds server to be served on port when the app is started.
+func (a *App) AddGRPC(server *grpc.Server, port int) *GRPCServer {
+	return a.addGRPCState(&grpcState{
+		listenState: newListenState("tcp", portAddr(port), nil),
+		grpcServer:  server,
+	})
+}
+
+// AddGRPCListener adds server to be served on connections accepted by l
+// when the app is started.
+func (a *App) AddGRPCListener(server *grpc.Server, l net.Listener) *GRPCServer {
+	return a.addGRPCState(&grpcState{
+		listenState: newListenState(l.Addr().Network(), l.Addr().String(), l),
+		grpcServer:  server,
+	})
+}
+
+func (a *App) addGRPCState(s *grpcState) *GRPCServer {
+	a.grpcServers = append(a.grpcServers, s)
+
+	return &GRPCServer{state: s}
+}
+
+func (a *App) startGRPCServers(ctx context.Context) {
+	for _, s := range a.grpcServers {
+		if err := s.listen(); err != nil {
+			a.logger.Fatal().Err(err).Str("network", s.network).Str("address", s.address).Msg("Cannot listen for gRPC server")
+		}
+
+		close(s.listening)
+		a.runGRPCServe(s)
+		a.wg.Add(1)
+	}
+}
+
+func (a *App) runGRPCServe(s *grpcState) {
+	go func() {
+		defer a.wg.Done()
+
+		if err := s.grpcServer.Serve(s.listener); err != nil {
+			a.logger.Error().Err(err).Str("address", s.listener.Addr().String()).Msg("gRPC server did not exit gracefully")
+		}
+		a.logger.Debug().Str("address", s.listener.Addr().String()).Msg("gRPC server shutdown")
+	}()
+}
+
+// stopGRPCServers gracefully stops the gRPC servers, forcibly stopping any
+// that have not finished handling in-flight RPCs when ctx is done.
+func (a *App) stopGRPCServers(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, s := range a.grpcServers {
+		wg.Add(1)
+		go func(s *grpcState) {
+			defer wg.Done()
+
+			stopped := make(chan struct{})
+			go func() {
+				s.grpcServer.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				a.logger.Error().Err(ctx.Err()).Str("address", s.address).Msg("gRPC server did not stop gracefully, closing connections")
+				s.grpcServer.Stop()
+			}
+		}(s)
+	}
+
+	wg.Wait()
+}
+
+// getGRPCMetrics returns the gRPC metrics, creating them the first time
+// they are needed so that several servers can share them.
+func (a *App) getGRPCMetrics() *grpcMetrics {
+	a.grpcMetricsOnce.Do(func() {
+		a.grpcMetrics = &grpcMetrics{
+			handled:  a.Metrics.NewCounterVec("grpc_server_handled_total", "The total number of RPCs completed on the server", []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"}),
+			duration: a.Metrics.NewHistogramVec("grpc_server_handling_seconds", "The duration taken to handle the RPC", []string{"grpc_type", "grpc_service", "grpc_method"}),
+		}
+	})
+
+	return a.grpcMetrics
+}
+
+func (a *App) newGRPCHealthServer() *health.Server {
+	hs := health.NewServer()
+
+	setStatus := func(ready bool) {
+		if ready {
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		} else {
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+	}
+
+	setStatus(a.Health.Ready())
+	a.Health.OnChange(setStatus)
+
+	return hs
+}
+
+func (a *App) unaryServerInterceptor(m *grpcMetrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		a.observeRPC(m, "unary", info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+func (a *App) streamServerInterceptor(m *grpcMetrics) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		a.observeRPC(m, streamType(info), info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func (a *App) observeRPC(m *grpcMetrics, rpcType string, fullMethod string, start time.Time, err error) {
+	service, method := splitFullMethod(fullMethod)
+	code := status.Code(err)
+
+	m.handled.With(prometheus.Labels{"grpc_type": rpcType, "grpc_service": service, "grpc_method": method, "grpc_code": code.String()}).Inc()
+	m.duration.With(prometheus.Labels{"grpc_type": rpcType, "grpc_service": service, "grpc_method": method}).Observe(time.Since(start).Seconds())
+
+	a.logger.Debug().Err(err).Str("grpcService", service).Str("grpcMethod", method).Str("grpcCode", code.String()).Dur("duration", time.Since(start)).Msg("Handled RPC")
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+// splitFullMethod splits a gRPC method name of the form "/package.Service/Method".
+func splitFullMethod(fullMethod string) (service string, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+
+	return "unknown", "unknown"
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestAddGRPC(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	server := app.NewGRPCServer()
+	app.AddGRPC(server, 9000)
+
+	require.Len(t, app.grpcServers, 1)
+	assert.Equal(t, server, app.grpcServers[0].grpcServer)
+	assert.Equal(t, ":9000", app.grpcServers[0].address)
+}
+
+func TestNewGRPCServerTwice(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	assert.NotPanics(t, func() {
+		app.NewGRPCServer()
+		app.NewGRPCServer()
+	})
+}
+
+func TestGRPCHealth(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	s := app.AddGRPC(app.NewGRPCServer(), 0)
+
+	done := make(chan struct{})
+	go func() {
+		app.Start()
+		close(done)
+	}()
+
+	select {
+	case <-s.Listening():
+	case <-time.After(time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	conn, err := grpc.NewClient(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+
+	assert.Eventually(t, func() bool {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	app.Stop()
+	<-done
+}
+
+func TestSplitFullMethod(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		outService string
+		outMethod  string
+	}{
+		{name: "full method", in: "/pkg.Service/Method", outService: "pkg.Service", outMethod: "Method"},
+		{name: "malformed", in: "Method", outService: "unknown", outMethod: "unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, method := splitFullMethod(tc.in)
+			assert.Equal(t, tc.outService, service)
+			assert.Equal(t, tc.outMethod, method)
+		})
+	}
+}
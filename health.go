@@ -0,0 +1,90 @@
+package app
+
+import (
+	"net/http"
+	"sync"
+)
+
+// HealthConfig holds configuration for the health check endpoints.
+type HealthConfig struct {
+	Enabled   bool   `desc:"Serve the health check endpoints"`
+	Port      int    `default:"8086" validate:"min=1,max=65535" desc:"Port of the health check endpoints"`
+	LivePath  string `default:"/live" desc:"Path of the liveness endpoint"`
+	ReadyPath string `default:"/ready" desc:"Path of the readiness endpoint"`
+}
+
+// Health tracks the readiness of the app to receive traffic.
+type Health struct {
+	mu        sync.RWMutex
+	ready     bool
+	listeners []func(ready bool)
+}
+
+// NewHealth returns a new Health in the not ready state.
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Ready reports whether the app is ready to receive traffic.
+func (h *Health) Ready() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.ready
+}
+
+// SetReady changes the readiness state and notifies any listeners
+// if the state has changed.
+func (h *Health) SetReady(ready bool) {
+	h.mu.Lock()
+	changed := h.ready != ready
+	h.ready = ready
+	listeners := h.listeners
+	h.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	for _, l := range listeners {
+		l(ready)
+	}
+}
+
+// OnChange registers f to be called whenever the readiness state changes.
+func (h *Health) OnChange(f func(ready bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.listeners = append(h.listeners, f)
+}
+
+// LiveHandler returns an http.Handler that always reports the app as alive.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+}
+
+// ReadyHandler returns an http.Handler that reports the readiness state, responding
+// with 503 Service Unavailable when the app is not ready.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+}
+
+// AddHealth adds liveness and readiness endpoints, served by an HTTP server on port.
+func (a *App) AddHealth(livePath, readyPath string, port int) {
+	mux := a.muxForPort(port)
+	mux.Handle(livePath, a.Health.LiveHandler())
+	mux.Handle(readyPath, a.Health.ReadyHandler())
+}
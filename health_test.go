@@ -0,0 +1,68 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHealth(t *testing.T) {
+	h := NewHealth()
+
+	assert.False(t, h.Ready())
+}
+
+func TestHealthSetReady(t *testing.T) {
+	h := NewHealth()
+
+	var changes []bool
+	h.OnChange(func(ready bool) { changes = append(changes, ready) })
+
+	h.SetReady(true)
+	h.SetReady(true)
+	h.SetReady(false)
+
+	assert.False(t, h.Ready())
+	assert.Equal(t, []bool{true, false}, changes, "listeners should only be notified of changes")
+}
+
+func TestHealthReadyHandler(t *testing.T) {
+	testCases := []struct {
+		name    string
+		ready   bool
+		outCode int
+	}{
+		{name: "ready", ready: true, outCode: http.StatusOK},
+		{name: "not ready", ready: false, outCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHealth()
+			h.SetReady(tc.ready)
+
+			rec := httptest.NewRecorder()
+			h.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			assert.Equal(t, tc.outCode, rec.Code)
+		})
+	}
+}
+
+func TestHealthLiveHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHealth().LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAddHealth(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddHealth("/live", "/ready", 8086)
+
+	require.Len(t, app.httpServers, 1)
+	assert.Equal(t, 8086, app.httpServers[0].httpPort)
+}
@@ -4,50 +4,159 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type httpState struct {
-	httpHandler http.Handler
-	httpPort    int
-	httpServer  *http.Server
+	listenState
+	httpHandler  http.Handler
+	httpPort     int
+	httpServer   *http.Server
+	instrumented bool
+	h2c          bool
+}
+
+// HttpServer is a handle to an HTTP server added to the app.
+type HttpServer struct {
+	state *httpState
+}
+
+// Addr returns the address the server is bound to, or nil if the
+// server is not yet listening. When the server was added with port 0
+// this is the address of the port chosen by the system.
+func (s *HttpServer) Addr() net.Addr {
+	return s.state.addr()
+}
+
+// Listening returns a channel that is closed once the server is bound
+// to its address.
+func (s *HttpServer) Listening() <-chan struct{} {
+	return s.state.listening
+}
+
+// HttpOption configures an HTTP server added to the app.
+type HttpOption func(s *httpState)
+
+// WithH2C serves HTTP/2 over cleartext (h2c) in addition to HTTP/1.x,
+// allowing HTTP/2 clients to connect without TLS.
+func WithH2C() HttpOption {
+	return func(s *httpState) {
+		s.h2c = true
+	}
 }
 
-func (a *App) AddHttp(handler http.Handler, port int) {
-	s := &httpState{
+// AddHttp adds an HTTP server for handler listening on port. A port of 0
+// will bind to a port chosen by the system, available through the
+// returned HttpServer once the app is started.
+func (a *App) AddHttp(handler http.Handler, port int, opts ...HttpOption) *HttpServer {
+	return a.addHttpState(&httpState{
+		listenState: newListenState("tcp", portAddr(port), nil),
 		httpHandler: handler,
 		httpPort:    port,
+	}, opts)
+}
+
+// AddHttpAddr adds an HTTP server for handler listening on addr. The address
+// may be a TCP address such as ":8080" or "tcp://127.0.0.1:8080", or a Unix
+// domain socket such as "unix:///var/run/app.sock".
+func (a *App) AddHttpAddr(handler http.Handler, addr string, opts ...HttpOption) *HttpServer {
+	network, address := parseListenAddr(addr)
+
+	return a.addHttpState(&httpState{
+		listenState: newListenState(network, address, nil),
+		httpHandler: handler,
+	}, opts)
+}
+
+// AddHttpListener adds an HTTP server for handler that will serve connections
+// accepted on l, e.g. a listener inherited through systemd socket activation.
+func (a *App) AddHttpListener(handler http.Handler, l net.Listener, opts ...HttpOption) *HttpServer {
+	return a.addHttpState(&httpState{
+		listenState: newListenState(l.Addr().Network(), l.Addr().String(), l),
+		httpHandler: handler,
+	}, opts)
+}
+
+func (a *App) addHttpState(s *httpState, opts []HttpOption) *HttpServer {
+	s.instrumented = true
+
+	for _, opt := range opts {
+		opt(s)
 	}
 
 	a.httpServers = append(a.httpServers, s)
+
+	return &HttpServer{state: s}
 }
 
 func (a *App) startHttpServers(ctx context.Context) {
 	for _, s := range a.httpServers {
-		s.httpServer = newHttpServer(s.httpHandler, s.httpPort)
-		a.runListenAndServe(s)
+		if err := s.listen(); err != nil {
+			a.logger.Fatal().Err(err).Str("network", s.network).Str("address", s.address).Msg("Cannot listen for HTTP server")
+		}
+
+		handler := s.httpHandler
+		if s.instrumented {
+			handler = a.traceHandler(correlationHandler(handler))
+		}
+		if s.h2c {
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+
+		httpServer := newHttpServer(handler, s.httpPort)
+		httpServer.Addr = s.listener.Addr().String()
+
+		a.onShutdownMu.Lock()
+		for _, f := range a.onShutdown {
+			httpServer.RegisterOnShutdown(f)
+		}
+		s.httpServer = httpServer
+		a.onShutdownMu.Unlock()
+
+		close(s.listening)
+		a.runServe(s)
 		a.wg.Add(1)
 	}
 }
 
+// stopHttpServers shuts down the HTTP servers concurrently, so that each has
+// until ctx is done to drain, closing the connections of any that have not.
 func (a *App) stopHttpServers(ctx context.Context) {
+	var wg sync.WaitGroup
+
 	for _, s := range a.httpServers {
-		if err := s.httpServer.Shutdown(ctx); err != nil {
-			panic(err)
-		}
+		wg.Add(1)
+		go func(s *httpState) {
+			defer wg.Done()
+
+			if err := s.httpServer.Shutdown(ctx); err != nil {
+				a.logger.Error().Err(err).Str("address", s.httpServer.Addr).Msg("HTTP server did not shutdown gracefully, closing connections")
+
+				if err := s.httpServer.Close(); err != nil {
+					a.logger.Error().Err(err).Str("address", s.httpServer.Addr).Msg("Failed to close HTTP server")
+				}
+			}
+		}(s)
 	}
+
+	wg.Wait()
 }
 
-func (a *App) runListenAndServe(s *httpState) {
+func (a *App) runServe(s *httpState) {
 	go func() {
 		defer a.wg.Done()
 
-		if err := s.httpServer.ListenAndServe(); err != nil {
+		if err := s.httpServer.Serve(s.listener); err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				panic(fmt.Errorf("server did not exit gracefully: %w", err))
 			}
 		}
-		a.logger.Debug().Msg("HTTP server shutdown")
+		a.logger.Debug().Str("address", s.httpServer.Addr).Msg("HTTP server shutdown")
 	}()
 }
 
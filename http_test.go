@@ -1,11 +1,19 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
 )
 
 func TestAddHttp(t *testing.T) {
@@ -18,6 +26,105 @@ func TestAddHttp(t *testing.T) {
 	assert.Equal(t, 8080, app.httpServers[0].httpPort, "Wrong port")
 }
 
+func TestAddHttpAddr(t *testing.T) {
+	testCases := []struct {
+		name       string
+		inAddr     string
+		outNetwork string
+		outAddress string
+	}{
+		{name: "port only", inAddr: ":8080", outNetwork: "tcp", outAddress: ":8080"},
+		{name: "tcp scheme", inAddr: "tcp://127.0.0.1:8080", outNetwork: "tcp", outAddress: "127.0.0.1:8080"},
+		{name: "unix scheme", inAddr: "unix:///tmp/app.sock", outNetwork: "unix", outAddress: "/tmp/app.sock"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := NewApp(NewAppConfig("MyApp").Build())
+			app.AddHttpAddr(http.NewServeMux(), tc.inAddr)
+
+			require.Len(t, app.httpServers, 1)
+			assert.Equal(t, tc.outNetwork, app.httpServers[0].network)
+			assert.Equal(t, tc.outAddress, app.httpServers[0].address)
+		})
+	}
+}
+
+func TestAddHttpListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddHttpListener(http.NewServeMux(), l)
+
+	require.Len(t, app.httpServers, 1)
+	assert.Equal(t, l, app.httpServers[0].listener)
+}
+
+func TestHttpServerEphemeralPort(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s := app.AddHttp(handler, 0)
+
+	assert.Nil(t, s.Addr(), "address should not be available before start")
+
+	done := make(chan struct{})
+	go func() {
+		app.Start()
+		close(done)
+	}()
+
+	select {
+	case <-s.Listening():
+	case <-time.After(time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	require.NotNil(t, s.Addr())
+	resp, err := http.Get("http://" + s.Addr().String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	app.Stop()
+	<-done
+}
+
+func TestWithH2C(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	s := app.AddHttp(handler, 0, WithH2C())
+
+	done := make(chan struct{})
+	go func() {
+		app.Start()
+		close(done)
+	}()
+	<-s.Listening()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	resp, err := client.Get("http://" + s.Addr().String())
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", string(body))
+
+	app.Stop()
+	<-done
+}
+
 func TestNewHTTPServer(t *testing.T) {
 	handler := http.NewServeMux()
 	server := newHttpServer(handler, 8081)
@@ -25,3 +132,149 @@ func TestNewHTTPServer(t *testing.T) {
 	assert.Equal(t, handler, server.Handler, "Handler not set")
 	assert.Equal(t, ":8081", server.Addr, "Addr not set")
 }
+
+func TestStopHttpServersClosesAfterTimeout(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	s := &httpState{httpHandler: handler, httpServer: newHttpServer(handler, 0)}
+	app.httpServers = append(app.httpServers, s)
+	go s.httpServer.Serve(l)
+
+	reqErr := make(chan error, 1)
+	go func() {
+		_, err := http.Get("http://" + l.Addr().String())
+		reqErr <- err
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	app.stopHttpServers(ctx)
+
+	select {
+	case err := <-reqErr:
+		assert.Error(t, err, "request should fail when connection is closed")
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
+
+func TestStopHttpServersConcurrently(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var started sync.WaitGroup
+	handlers := []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) {
+			started.Done()
+			<-release
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			started.Done()
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+
+	var addrs []string
+	resps := make(chan *http.Response, 1)
+	for i, handler := range handlers {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrs = append(addrs, l.Addr().String())
+
+		s := &httpState{httpHandler: handler, httpServer: newHttpServer(handler, 0)}
+		app.httpServers = append(app.httpServers, s)
+		go s.httpServer.Serve(l)
+
+		started.Add(1)
+		go func(i int) {
+			resp, err := http.Get("http://" + l.Addr().String())
+			if i == 1 && err == nil {
+				resps <- resp
+			}
+		}(i)
+	}
+
+	started.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		app.stopHttpServers(ctx)
+		close(stopped)
+	}()
+
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addrs[1])
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 100*time.Millisecond, 5*time.Millisecond, "second server should stop listening while the first drains")
+
+	select {
+	case resp := <-resps:
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "second server should drain its request")
+	case <-time.After(time.Second):
+		t.Fatal("request to second server failed")
+	}
+
+	<-stopped
+}
+
+func TestRegisterOnShutdown(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	var calls int
+	app.RegisterOnShutdown(func() { calls++ })
+
+	require.Len(t, app.onShutdown, 1)
+	app.onShutdown[0]()
+	app.onShutdown[0]()
+
+	assert.Equal(t, 1, calls, "shutdown func should only be called once")
+}
+
+func TestRegisterOnShutdownAfterStart(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+	s := app.AddHttp(http.NewServeMux(), 0)
+
+	var before, after atomic.Int32
+	app.RegisterOnShutdown(func() { before.Add(1) })
+
+	done := make(chan struct{})
+	go func() {
+		app.Start()
+		close(done)
+	}()
+	<-s.Listening()
+
+	app.RegisterOnShutdown(func() { after.Add(1) })
+
+	app.Stop()
+	<-done
+
+	assert.Eventually(t, func() bool {
+		return before.Load() == 1 && after.Load() == 1
+	}, time.Second, 10*time.Millisecond, "shutdown funcs should be called once each")
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// listenState holds the address a server listens on and, once bound,
+// the listener accepting its connections.
+type listenState struct {
+	network   string
+	address   string
+	listener  net.Listener
+	listening chan struct{}
+}
+
+func newListenState(network, address string, l net.Listener) listenState {
+	return listenState{
+		network:   network,
+		address:   address,
+		listener:  l,
+		listening: make(chan struct{}),
+	}
+}
+
+// listen binds the listener if one was not supplied when the server was added.
+func (s *listenState) listen() error {
+	if s.listener != nil {
+		return nil
+	}
+
+	l, err := net.Listen(s.network, s.address)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+
+	return nil
+}
+
+func (s *listenState) addr() net.Addr {
+	select {
+	case <-s.listening:
+		return s.listener.Addr()
+	default:
+		return nil
+	}
+}
+
+// portAddr returns the TCP address for listening on port on all interfaces.
+func portAddr(port int) string {
+	return fmt.Sprintf(":%d", port)
+}
+
+// parseListenAddr splits addr into the network and address expected by net.Listen.
+func parseListenAddr(addr string) (network string, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		return "tcp", strings.TrimPrefix(addr, "tcp://")
+	default:
+		return "tcp", addr
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Log output formats supported by LogConfig.Format.
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+	LogFormatECS     = "ecs"
+	LogFormatGCP     = "gcp"
+)
+
+// newConfiguredLogger creates the app's logger from config, opening the
+// configured output through output. A logger or writer supplied through
+// AppConfig.WithLogger or AppConfig.WithLogWriter takes the place of the
+// configured output.
+func newConfiguredLogger(config AppConfig, output *logOutput) (zerolog.Logger, error) {
+	if config.logger != nil {
+		return config.logger.With().Str("appName", config.Name).Logger(), nil
+	}
+
+	out := config.logWriter
+	if out == nil {
+		w, err := output.open(config.Log.Output)
+		if err != nil {
+			return zerolog.Logger{}, err
+		}
+		out = w
+	}
+
+	out, err := formatLogOutput(out, config.Log.Format)
+	if err != nil {
+		return zerolog.Logger{}, err
+	}
+
+	ctx := zerolog.New(out).With().Str("appName", config.Name)
+	if config.Log.Caller {
+		ctx = ctx.Caller()
+	}
+	logger := ctx.Logger()
+
+	if config.Log.TimeFormat != "" && config.Log.TimeFormat != "none" {
+		logger = logger.Hook(timestampHook{format: config.Log.TimeFormat})
+	}
+
+	return logger, nil
+}
+
+// openLogOutput returns the writer for output, which may be stderr, stdout
+// or the path of a file to append to.
+func openLogOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	default:
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening log output %q: %w", output, err)
+		}
+		return f, nil
+	}
+}
+
+// logOutput holds the files the app logs to, so that each is opened once
+// however many times the logger is created, and closed when the app shuts down.
+type logOutput struct {
+	files map[string]*os.File
+}
+
+// open returns the writer for output as openLogOutput does, reusing the file
+// if output names one that is already open.
+func (o *logOutput) open(output string) (io.Writer, error) {
+	if f, ok := o.files[output]; ok {
+		return f, nil
+	}
+
+	w, err := openLogOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		if o.files == nil {
+			o.files = make(map[string]*os.File)
+		}
+		o.files[output] = f
+	}
+
+	return w, nil
+}
+
+// Close closes the files the app logs to.
+func (o *logOutput) Close() error {
+	var errs []error
+	for _, f := range o.files {
+		errs = append(errs, f.Close())
+	}
+	o.files = nil
+
+	return errors.Join(errs...)
+}
+
+// formatLogOutput wraps out to write log events in format.
+func formatLogOutput(out io.Writer, format string) (io.Writer, error) {
+	switch format {
+	case "", LogFormatJSON:
+		return out, nil
+	case LogFormatConsole:
+		return zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}, nil
+	case LogFormatECS:
+		return &fieldRenameWriter{out: out, rename: ecsField, extra: `"ecs.version":"1.6.0"`}, nil
+	case LogFormatGCP:
+		return &fieldRenameWriter{out: out, rename: gcpField}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// timestampHook adds the time of each event formatted according to format,
+// which is one of rfc3339, rfc3339nano, unix, unixms or a time.Format layout.
+type timestampHook struct {
+	format string
+}
+
+func (h timestampHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	now := time.Now()
+
+	switch h.format {
+	case "rfc3339":
+		e.Str(zerolog.TimestampFieldName, now.Format(time.RFC3339))
+	case "rfc3339nano":
+		e.Str(zerolog.TimestampFieldName, now.Format(time.RFC3339Nano))
+	case "unix":
+		e.Int64(zerolog.TimestampFieldName, now.Unix())
+	case "unixms":
+		e.Int64(zerolog.TimestampFieldName, now.UnixNano()/int64(time.Millisecond))
+	default:
+		e.Str(zerolog.TimestampFieldName, now.Format(h.format))
+	}
+}
+
+// fieldRenameWriter rewrites the top-level fields of each JSON log event,
+// preserving their order, before writing it to out. extra is raw JSON
+// appended to every event.
+type fieldRenameWriter struct {
+	out    io.Writer
+	rename func(key string, value json.RawMessage) (string, json.RawMessage)
+	extra  string
+}
+
+func (w *fieldRenameWriter) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return w.out.Write(p)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return w.out.Write(p)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return w.out.Write(p)
+		}
+
+		key, value := w.rename(t.(string), value)
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	if w.extra != "" {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(w.extra)
+	}
+	buf.WriteString("}\n")
+
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// ecsField maps zerolog field names to Elastic Common Schema names.
+func ecsField(key string, value json.RawMessage) (string, json.RawMessage) {
+	switch key {
+	case zerolog.TimestampFieldName:
+		return "@timestamp", value
+	case zerolog.LevelFieldName:
+		return "log.level", value
+	case zerolog.ErrorFieldName:
+		return "error.message", value
+	case zerolog.CallerFieldName:
+		return "log.origin.file.name", value
+	}
+
+	return key, value
+}
+
+// gcpSeverities maps zerolog levels to Google Cloud Logging severities.
+var gcpSeverities = map[string]string{
+	"trace": "DEBUG",
+	"debug": "DEBUG",
+	"info":  "INFO",
+	"warn":  "WARNING",
+	"error": "ERROR",
+	"fatal": "CRITICAL",
+	"panic": "ALERT",
+}
+
+// gcpField maps zerolog field names and levels to those expected by
+// Google Cloud Logging.
+func gcpField(key string, value json.RawMessage) (string, json.RawMessage) {
+	switch key {
+	case zerolog.TimestampFieldName:
+		return "timestamp", value
+	case zerolog.LevelFieldName:
+		var level string
+		if err := json.Unmarshal(value, &level); err == nil {
+			if severity, ok := gcpSeverities[strings.ToLower(level)]; ok {
+				value, _ = json.Marshal(severity)
+			}
+		}
+		return "severity", value
+	}
+
+	return key, value
+}
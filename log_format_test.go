@@ -0,0 +1,155 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfiguredLoggerFormats(t *testing.T) {
+	testCases := []struct {
+		name      string
+		format    string
+		outFields map[string]interface{}
+		outAbsent []string
+	}{
+		{name: "json", format: "json", outFields: map[string]interface{}{"level": "warn", "message": "test"}},
+		{name: "ecs", format: "ecs", outFields: map[string]interface{}{"log.level": "warn", "message": "test", "ecs.version": "1.6.0"}, outAbsent: []string{"level", "time"}},
+		{name: "gcp", format: "gcp", outFields: map[string]interface{}{"severity": "WARNING", "message": "test"}, outAbsent: []string{"level", "time"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			config := NewAppConfig("MyApp").WithLogWriter(buf)
+			config.Log = LogConfig{Format: tc.format, TimeFormat: "rfc3339"}
+
+			logger, err := newConfiguredLogger(config, &logOutput{})
+			require.NoError(t, err)
+			logger.Warn().Msg("test")
+
+			var event map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+
+			for k, v := range tc.outFields {
+				assert.Equal(t, v, event[k], k)
+			}
+			for _, k := range tc.outAbsent {
+				assert.NotContains(t, event, k)
+			}
+			assert.Equal(t, "MyApp", event["appName"])
+		})
+	}
+}
+
+func TestNewConfiguredLoggerConsole(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := NewAppConfig("MyApp").WithLogWriter(buf)
+	config.Log = LogConfig{Format: "console"}
+
+	logger, err := newConfiguredLogger(config, &logOutput{})
+	require.NoError(t, err)
+	logger.Warn().Msg("test")
+
+	assert.Contains(t, buf.String(), "WRN")
+	assert.Contains(t, buf.String(), "test")
+}
+
+func TestNewConfiguredLoggerInvalidFormat(t *testing.T) {
+	config := NewAppConfig("MyApp").WithLogWriter(&bytes.Buffer{})
+	config.Log = LogConfig{Format: "xml"}
+
+	_, err := newConfiguredLogger(config, &logOutput{})
+	assert.Error(t, err)
+}
+
+func TestNewConfiguredLoggerWithLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := NewAppConfig("MyApp").WithLogger(zerolog.New(buf).With().Str("foo", "bar").Logger())
+
+	logger, err := newConfiguredLogger(config, &logOutput{})
+	require.NoError(t, err)
+	logger.Warn().Msg("test")
+
+	assert.Contains(t, buf.String(), `"foo":"bar"`)
+	assert.Contains(t, buf.String(), `"appName":"MyApp"`)
+}
+
+func TestNewConfiguredLoggerCaller(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := NewAppConfig("MyApp").WithLogWriter(buf)
+	config.Log = LogConfig{Caller: true}
+
+	logger, err := newConfiguredLogger(config, &logOutput{})
+	require.NoError(t, err)
+	logger.Warn().Msg("test")
+
+	assert.Contains(t, buf.String(), "log_format_test.go")
+}
+
+func TestTimestampHook(t *testing.T) {
+	testCases := []struct {
+		name    string
+		format  string
+		outType interface{}
+	}{
+		{name: "rfc3339", format: "rfc3339", outType: ""},
+		{name: "unix", format: "unix", outType: float64(0)},
+		{name: "layout", format: "2006-01-02", outType: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := zerolog.New(buf).Hook(timestampHook{format: tc.format})
+			logger.Info().Msg("test")
+
+			var event map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+			require.Contains(t, event, "time")
+			assert.IsType(t, tc.outType, event["time"])
+		})
+	}
+}
+
+func TestOpenLogOutput(t *testing.T) {
+	w, err := openLogOutput("stdout")
+	require.NoError(t, err)
+	assert.Equal(t, os.Stdout, w)
+
+	w, err = openLogOutput("")
+	require.NoError(t, err)
+	assert.Equal(t, os.Stderr, w)
+
+	_, err = openLogOutput("/nonexistent/dir/app.log")
+	assert.Error(t, err)
+}
+
+func TestLogOutputOpensFileOnce(t *testing.T) {
+	dir := t.TempDir()
+	o := &logOutput{}
+
+	w, err := o.open(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	again, err := o.open(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	assert.Same(t, w, again, "file should be opened once")
+
+	other, err := o.open(filepath.Join(dir, "other.log"))
+	require.NoError(t, err)
+	stderr, err := o.open("stderr")
+	require.NoError(t, err)
+
+	require.NoError(t, o.Close())
+	_, err = w.Write([]byte("test"))
+	assert.Error(t, err, "file should be closed")
+	_, err = other.Write([]byte("test"))
+	assert.Error(t, err, "file should be closed")
+	assert.Equal(t, os.Stderr, stderr)
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// LogSamplingConfig holds configuration for sampling log events to limit the
+// volume logged from hot paths. Bursts sets, per level, the number of events
+// allowed in each period, e.g. debug:10,info:100. Events beyond the burst are
+// dropped until the period ends. Period applies to every level unless
+// overridden for a level in Periods, e.g. debug:10s. Levels without a burst
+// are not sampled.
+type LogSamplingConfig struct {
+	Bursts  map[string]uint32        `desc:"Events logged per period at each level, e.g. info:100,debug:10"`
+	Period  time.Duration            `default:"1s" desc:"Sampling period"`
+	Periods map[string]time.Duration `desc:"Sampling period of each level, e.g. debug:10s"`
+}
+
+// logSampling holds a burst sampler for each sampled level.
+type logSampling struct {
+	samplers map[zerolog.Level]*zerolog.BurstSampler
+}
+
+func newLogSampling(config LogSamplingConfig) (*logSampling, error) {
+	if len(config.Bursts) == 0 {
+		return nil, nil
+	}
+
+	s := &logSampling{samplers: make(map[zerolog.Level]*zerolog.BurstSampler)}
+
+	for name, burst := range config.Bursts {
+		lvl, err := zerolog.ParseLevel(strings.ToLower(name))
+		if err != nil || lvl == zerolog.NoLevel {
+			return nil, fmt.Errorf("invalid log sampling level %q", name)
+		}
+
+		period := config.Period
+		if p, ok := config.Periods[name]; ok {
+			period = p
+		}
+		if period <= 0 {
+			period = time.Second
+		}
+
+		s.samplers[lvl] = &zerolog.BurstSampler{Burst: burst, Period: period}
+	}
+
+	return s, nil
+}
+
+// sample reports whether an event at lvl is within the burst for its level.
+func (s *logSampling) sample(lvl zerolog.Level) bool {
+	if s == nil {
+		return true
+	}
+
+	sampler, ok := s.samplers[lvl]
+	if !ok {
+		return true
+	}
+
+	return sampler.Sample(lvl)
+}
+
+// logSampler is the zerolog.Sampler applied to the app's loggers. It filters
+// events below the current log level and then applies any sampling, counting
+// events dropped by sampling.
+type logSampler struct {
+	level     *logLevel
+	sampling  *logSampling
+	component string
+	dropped   *prometheus.CounterVec
+}
+
+// Sample implements zerolog.Sampler.
+func (s *logSampler) Sample(lvl zerolog.Level) bool {
+	if !s.level.Sample(lvl) {
+		return false
+	}
+
+	if !s.sampling.sample(lvl) {
+		if s.dropped != nil {
+			s.dropped.With(prometheus.Labels{"level": lvl.String(), "component": s.component}).Inc()
+		}
+		return false
+	}
+
+	return true
+}
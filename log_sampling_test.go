@@ -0,0 +1,77 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogSampling(t *testing.T) {
+	s, err := newLogSampling(LogSamplingConfig{
+		Bursts:  map[string]uint32{"debug": 10, "INFO": 100},
+		Period:  time.Second,
+		Periods: map[string]time.Duration{"debug": 10 * time.Second},
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, s.samplers, zerolog.DebugLevel)
+	assert.Equal(t, uint32(10), s.samplers[zerolog.DebugLevel].Burst)
+	assert.Equal(t, 10*time.Second, s.samplers[zerolog.DebugLevel].Period)
+
+	require.Contains(t, s.samplers, zerolog.InfoLevel)
+	assert.Equal(t, uint32(100), s.samplers[zerolog.InfoLevel].Burst)
+	assert.Equal(t, time.Second, s.samplers[zerolog.InfoLevel].Period)
+}
+
+func TestNewLogSamplingDisabled(t *testing.T) {
+	s, err := newLogSampling(LogSamplingConfig{})
+
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+	assert.True(t, s.sample(zerolog.DebugLevel), "nil sampling should allow all events")
+}
+
+func TestNewLogSamplingInvalidLevel(t *testing.T) {
+	_, err := newLogSampling(LogSamplingConfig{Bursts: map[string]uint32{"loud": 1}})
+
+	assert.Error(t, err)
+}
+
+func TestLogSamplerDropsAndCounts(t *testing.T) {
+	sampling, err := newLogSampling(LogSamplingConfig{Bursts: map[string]uint32{"debug": 2}, Period: time.Hour})
+	require.NoError(t, err)
+
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"level", "component"})
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf).Sample(&logSampler{level: newLogLevel(zerolog.DebugLevel), sampling: sampling, component: "foo", dropped: dropped})
+
+	for i := 0; i < 5; i++ {
+		logger.Debug().Msg("")
+		logger.Info().Msg("")
+	}
+
+	assert.Equal(t, 2, strings.Count(buf.String(), `"level":"debug"`), "debug events beyond burst should be dropped")
+	assert.Equal(t, 5, strings.Count(buf.String(), `"level":"info"`), "unsampled levels should not be dropped")
+	assert.Equal(t, float64(3), testutil.ToFloat64(dropped.With(prometheus.Labels{"level": "debug", "component": "foo"})))
+}
+
+func TestComponentLoggerSampling(t *testing.T) {
+	buf := &bytes.Buffer{}
+	app := NewApp(NewAppConfig("MyApp").WithLogWriter(buf))
+
+	logger := app.componentLogger("Foo", "", LogSamplingConfig{Bursts: map[string]uint32{"debug": 1}, Period: time.Hour})
+	logger.Debug().Msg("first")
+	logger.Debug().Msg("second")
+	app.logger.Debug().Msg("app")
+
+	assert.Contains(t, buf.String(), "first")
+	assert.NotContains(t, buf.String(), "second")
+	assert.Contains(t, buf.String(), "app", "app logger should not use component sampling")
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// LogConfig holds configuration for the app's logging. Level overrides the
+// default level for the app's environment. Output is stderr, stdout or the
+// path of a file, and Format is one of json, console, ecs or gcp. TimeFormat
+// is one of rfc3339, rfc3339nano, unix, unixms, none or a time.Format layout.
+// Caller adds the file and line number of the logging call to each event.
+// Sampling limits the volume of events logged at each level.
+type LogConfig struct {
+	Level      string `desc:"Log level, overriding the default for the environment"`
+	Output     string `default:"stderr" desc:"stderr, stdout or the path of a log file"`
+	Format     string `default:"json" validate:"oneof=json console ecs gcp" desc:"Log format: json, console, ecs or gcp"`
+	TimeFormat string `default:"rfc3339" desc:"Timestamp format: rfc3339, rfc3339nano, unix, unixms, none or a time.Format layout"`
+	Caller     bool   `desc:"Add the file and line of the logging call to each event"`
+	Sampling   LogSamplingConfig
+}
+
+// Validate checks that Level, if set, is a known log level.
+func (c *LogConfig) Validate() error {
+	if c.Level == "" {
+		return nil
+	}
+
+	if _, err := zerolog.ParseLevel(strings.ToLower(c.Level)); err != nil {
+		return fmt.Errorf("unknown log level %q", c.Level)
+	}
+
+	return nil
+}
+
+// logLevel is a log level that can be changed while the app is running.
+// It is applied to loggers as a zerolog.Sampler so that every logger derived
+// from them observes changes to the level. A logLevel with a parent and a
+// level of zerolog.NoLevel inherits the parent's level.
+type logLevel struct {
+	level  int32
+	parent *logLevel
+}
+
+func newLogLevel(l zerolog.Level) *logLevel {
+	return &logLevel{level: int32(l)}
+}
+
+// Level returns the current effective level.
+func (l *logLevel) Level() zerolog.Level {
+	lvl := zerolog.Level(atomic.LoadInt32(&l.level))
+	if lvl == zerolog.NoLevel && l.parent != nil {
+		return l.parent.Level()
+	}
+
+	return lvl
+}
+
+// SetLevel changes the current level. Setting zerolog.NoLevel on a
+// component's level reverts it to inheriting the app's level.
+func (l *logLevel) SetLevel(lvl zerolog.Level) {
+	atomic.StoreInt32(&l.level, int32(lvl))
+}
+
+// Sample implements zerolog.Sampler, allowing events at or above the current level.
+func (l *logLevel) Sample(lvl zerolog.Level) bool {
+	return lvl >= l.Level()
+}
+
+// logLevels holds the app's log level and those of named components,
+// such as SQS workers, whose level can be set independently.
+type logLevels struct {
+	mu         sync.RWMutex
+	initial    zerolog.Level
+	app        *logLevel
+	components map[string]*logLevel
+}
+
+func newLogLevels(initial zerolog.Level) *logLevels {
+	return &logLevels{
+		initial:    initial,
+		app:        newLogLevel(initial),
+		components: make(map[string]*logLevel),
+	}
+}
+
+// component returns the level for the named component, creating it to
+// inherit the app's level if it does not exist.
+func (l *logLevels) component(name string) *logLevel {
+	key := strings.ToLower(name)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.components[key]; ok {
+		return c
+	}
+
+	c := &logLevel{level: int32(zerolog.NoLevel), parent: l.app}
+	l.components[key] = c
+
+	return c
+}
+
+// lookup returns the app's level when name is empty, or else the level of
+// an existing component.
+func (l *logLevels) lookup(name string) (*logLevel, error) {
+	if name == "" {
+		return l.app, nil
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	c, ok := l.components[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown log component %q", name)
+	}
+
+	return c, nil
+}
+
+// increaseVerbosity lowers the app's level by one step, down to trace.
+func (l *logLevels) increaseVerbosity() zerolog.Level {
+	lvl := l.app.Level()
+	if lvl > zerolog.TraceLevel {
+		lvl--
+		l.app.SetLevel(lvl)
+	}
+
+	return lvl
+}
+
+// reset restores the app's level to its configured value.
+func (l *logLevels) reset() zerolog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	l.app.SetLevel(l.initial)
+
+	return l.initial
+}
+
+// setInitial changes the configured level of the app, applying it when it
+// differs from the current configured level. It reports whether the level
+// was changed.
+func (l *logLevels) setInitial(lvl zerolog.Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lvl == l.initial {
+		return false
+	}
+
+	l.initial = lvl
+	l.app.SetLevel(lvl)
+
+	return true
+}
+
+// componentLogger returns a logger for the named component whose level can be
+// changed independently of the app's level. Events are sampled according to
+// sampling, or the app's sampling if sampling has no bursts.
+func (a *App) componentLogger(name string, level string, sampling LogSamplingConfig) zerolog.Logger {
+	cl := a.logLevels.component(name)
+
+	if level != "" {
+		if err := a.setComponentLogLevel(name, level); err != nil {
+			a.logger.Error().Err(err).Str("component", name).Msg("Invalid component log level")
+		}
+	}
+
+	s, err := newLogSampling(sampling)
+	if err != nil {
+		a.logger.Error().Err(err).Str("component", name).Msg("Invalid component log sampling")
+	}
+	if s == nil {
+		s = a.logSampling
+	}
+
+	sampler := &logSampler{level: cl, sampling: s, component: name, dropped: a.logDropped}
+
+	return a.logger.Sample(sampler).With().Str("component", name).Logger()
+}
+
+// setComponentLogLevel sets the level of the named component to level, or to
+// inherit the app's level if level is empty.
+func (a *App) setComponentLogLevel(name string, level string) error {
+	lvl := zerolog.NoLevel
+	if level != "" {
+		var err error
+		if lvl, err = zerolog.ParseLevel(level); err != nil {
+			return err
+		}
+	}
+
+	a.logLevels.component(name).SetLevel(lvl)
+
+	return nil
+}
+
+// appLogLevel returns the configured log level for the app, or the default
+// level for the app's environment if none is configured.
+func appLogLevel(config AppConfig) (zerolog.Level, error) {
+	if config.Log.Level == "" {
+		return logLevelForEnv(config.Env), nil
+	}
+
+	lvl, err := zerolog.ParseLevel(strings.ToLower(config.Log.Level))
+	if err != nil {
+		return zerolog.NoLevel, fmt.Errorf("parsing log level %q: %w", config.Log.Level, err)
+	}
+
+	return lvl, nil
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// registerLogLevelSignals allows the log level to be changed by sending the
+// process signals. SIGUSR1 makes the app's logging one level more verbose and
+// SIGUSR2 restores the configured level.
+func (a *App) registerLogLevelSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range c {
+			switch sig {
+			case syscall.SIGUSR1:
+				lvl := a.logLevels.increaseVerbosity()
+				a.logger.Log().Str("level", lvl.String()).Msg("Increased log verbosity")
+			case syscall.SIGUSR2:
+				lvl := a.logLevels.reset()
+				a.logger.Log().Str("level", lvl.String()).Msg("Reset log level")
+			}
+		}
+	}()
+}
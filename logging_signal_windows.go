@@ -0,0 +1,4 @@
+package app
+
+// registerLogLevelSignals is a no-op on Windows, which has no SIGUSR1 or SIGUSR2.
+func (a *App) registerLogLevelSignals() {}
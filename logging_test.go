@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelAppliesToDerivedLoggers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lvl := newLogLevel(zerolog.WarnLevel)
+	logger := zerolog.New(buf).Sample(lvl)
+	derived := logger.With().Str("foo", "bar").Logger()
+
+	derived.Info().Msg("before")
+	assert.Empty(t, buf.String(), "info should be filtered at warn level")
+
+	lvl.SetLevel(zerolog.InfoLevel)
+	derived.Info().Msg("after")
+	assert.Contains(t, buf.String(), "after")
+}
+
+func TestComponentLogLevelInheritsAppLevel(t *testing.T) {
+	levels := newLogLevels(zerolog.WarnLevel)
+	c := levels.component("Orders")
+
+	assert.Equal(t, zerolog.WarnLevel, c.Level())
+
+	levels.app.SetLevel(zerolog.InfoLevel)
+	assert.Equal(t, zerolog.InfoLevel, c.Level(), "component should follow app level")
+
+	c.SetLevel(zerolog.DebugLevel)
+	assert.Equal(t, zerolog.DebugLevel, c.Level())
+	assert.Equal(t, zerolog.InfoLevel, levels.app.Level(), "app level should not change")
+
+	assert.Same(t, c, levels.component("orders"), "component names should be case insensitive")
+}
+
+func TestLogLevelsIncreaseVerbosityAndReset(t *testing.T) {
+	levels := newLogLevels(zerolog.InfoLevel)
+
+	assert.Equal(t, zerolog.DebugLevel, levels.increaseVerbosity())
+	assert.Equal(t, zerolog.TraceLevel, levels.increaseVerbosity())
+	assert.Equal(t, zerolog.TraceLevel, levels.increaseVerbosity(), "should not go below trace")
+
+	assert.Equal(t, zerolog.InfoLevel, levels.reset())
+	assert.Equal(t, zerolog.InfoLevel, levels.app.Level())
+}
+
+func TestAppLogLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   AppConfig
+		outLevel zerolog.Level
+		outErr   bool
+	}{
+		{name: "env default", config: AppConfig{Env: "prod"}, outLevel: zerolog.WarnLevel},
+		{name: "configured", config: AppConfig{Env: "prod", Log: LogConfig{Level: "info"}}, outLevel: zerolog.InfoLevel},
+		{name: "upper case", config: AppConfig{Env: "prod", Log: LogConfig{Level: "DEBUG"}}, outLevel: zerolog.DebugLevel},
+		{name: "invalid", config: AppConfig{Log: LogConfig{Level: "loud"}}, outErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lvl, err := appLogLevel(tc.config)
+
+			if tc.outErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.outLevel, lvl)
+		})
+	}
+}
+
+func TestReadLogLevelConfig(t *testing.T) {
+	os.Setenv("MY_APP_LOG_LEVEL", "error")
+	defer os.Unsetenv("MY_APP_LOG_LEVEL")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	assert.Equal(t, zerolog.ErrorLevel, app.logLevels.app.Level())
+}
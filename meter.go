@@ -0,0 +1,89 @@
+package app
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Meter creates the metrics recorded by the app's components, independent of
+// the backend they are shipped to. Label values passed when recording a
+// metric must match the label names it was created with, in the same order.
+// Histogram buckets are only used by backends that aggregate in the app, and
+// may be nil for the backend's defaults. Metrics is the Prometheus
+// implementation, used unless StatsD is enabled.
+type Meter interface {
+	Counter(name string, help string, labelNames ...string) Counter
+	Gauge(name string, help string, labelNames ...string) Gauge
+	Histogram(name string, help string, buckets []float64, labelNames ...string) Histogram
+}
+
+// Counter is a metric that only increases.
+type Counter interface {
+	Inc(labelValues ...string)
+	Add(delta float64, labelValues ...string)
+}
+
+// Gauge is a metric that can be set to any value.
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+}
+
+// Histogram is a metric that records the distribution of observed values.
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+func (m Metrics) Counter(name string, help string, labelNames ...string) Counter {
+	return promCounter{vec: m.NewCounterVec(name, help, labelNames)}
+}
+
+func (m Metrics) Gauge(name string, help string, labelNames ...string) Gauge {
+	return promGauge{vec: m.NewGaugeVec(name, help, labelNames)}
+}
+
+func (m Metrics) Histogram(name string, help string, buckets []float64, labelNames ...string) Histogram {
+	return promHistogram{vec: m.NewHistogramVec(name, help, labelNames, WithBuckets(buckets))}
+}
+
+type promCounter struct {
+	vec *prometheus.CounterVec
+}
+
+func (c promCounter) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+func (c promCounter) Add(delta float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type promGauge struct {
+	vec *prometheus.GaugeVec
+}
+
+func (g promGauge) Set(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+type promHistogram struct {
+	vec *prometheus.HistogramVec
+}
+
+func (h promHistogram) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
+
+func (h promHistogram) observeWithExemplar(value float64, exemplar map[string]string, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).(prometheus.ExemplarObserver).ObserveWithExemplar(value, exemplar)
+}
+
+// observeWithExemplar records value in h along with the exemplar labels, such
+// as a trace ID linking the observation to a specific request or message.
+// Exemplars are dropped by backends that do not support them.
+func observeWithExemplar(h Histogram, value float64, exemplar map[string]string, labelValues ...string) {
+	if eh, ok := h.(interface {
+		observeWithExemplar(value float64, exemplar map[string]string, labelValues ...string)
+	}); ok && len(exemplar) > 0 {
+		eh.observeWithExemplar(value, exemplar, labelValues...)
+		return
+	}
+
+	h.Observe(value, labelValues...)
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMeter is a Meter recording the last value of each metric, and the
+// total of counters, keyed by name and label values.
+type recordingMeter struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newRecordingMeter() *recordingMeter {
+	return &recordingMeter{values: map[string]float64{}}
+}
+
+func (m *recordingMeter) Counter(name string, help string, labelNames ...string) Counter {
+	return recordingMetric{meter: m, name: name}
+}
+
+func (m *recordingMeter) Gauge(name string, help string, labelNames ...string) Gauge {
+	return recordingMetric{meter: m, name: name}
+}
+
+func (m *recordingMeter) Histogram(name string, help string, buckets []float64, labelNames ...string) Histogram {
+	return recordingMetric{meter: m, name: name}
+}
+
+func (m *recordingMeter) value(name string, labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.values[recordingKey(name, labelValues)]
+}
+
+func (m *recordingMeter) record(name string, labelValues []string, f func(v float64) float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordingKey(name, labelValues)
+	m.values[key] = f(m.values[key])
+}
+
+func recordingKey(name string, labelValues []string) string {
+	return name + "{" + strings.Join(labelValues, ",") + "}"
+}
+
+type recordingMetric struct {
+	meter *recordingMeter
+	name  string
+}
+
+func (r recordingMetric) Inc(labelValues ...string) {
+	r.Add(1, labelValues...)
+}
+
+func (r recordingMetric) Add(delta float64, labelValues ...string) {
+	r.meter.record(r.name, labelValues, func(v float64) float64 { return v + delta })
+}
+
+func (r recordingMetric) Set(value float64, labelValues ...string) {
+	r.meter.record(r.name, labelValues, func(float64) float64 { return value })
+}
+
+func (r recordingMetric) Observe(value float64, labelValues ...string) {
+	r.meter.record(r.name, labelValues, func(float64) float64 { return value })
+}
+
+func TestMetricsMeter(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo"})
+
+	var meter Meter = m
+	meter.Counter("counter_total", "A counter", "l").Add(2, "a")
+	meter.Counter("counter_total", "A counter", "l").Inc("a")
+	meter.Gauge("gauge", "A gauge", "l").Set(3, "a")
+	meter.Histogram("histogram_seconds", "A histogram", []float64{1, 2}, "l").Observe(0.5, "a")
+
+	mfs := gatherMetrics(t, m)
+
+	require.Contains(t, mfs, "foo_counter_total")
+	assert.Equal(t, 3.0, mfs["foo_counter_total"].GetMetric()[0].GetCounter().GetValue())
+	require.Contains(t, mfs, "foo_gauge")
+	assert.Equal(t, 3.0, mfs["foo_gauge"].GetMetric()[0].GetGauge().GetValue())
+	require.Contains(t, mfs, "foo_histogram_seconds")
+	assert.Equal(t, uint64(1), mfs["foo_histogram_seconds"].GetMetric()[0].GetHistogram().GetSampleCount())
+}
+
+func TestObserveWithExemplar(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo"})
+
+	observeWithExemplar(m.Histogram("histogram_seconds", "A histogram", nil, "l"), 0.5, map[string]string{"trace_id": "abc123"}, "a")
+
+	mfs := gatherMetrics(t, m)
+	require.Contains(t, mfs, "foo_histogram_seconds")
+
+	var exemplars []map[string]string
+	for _, b := range mfs["foo_histogram_seconds"].GetMetric()[0].GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			exemplars = append(exemplars, metricLabels(&dto.Metric{Label: e.GetLabel()}))
+		}
+	}
+	assert.Equal(t, []map[string]string{{"trace_id": "abc123"}}, exemplars)
+}
+
+func TestObserveWithExemplarUnsupported(t *testing.T) {
+	m := newRecordingMeter()
+
+	observeWithExemplar(m.Histogram("histogram_seconds", "A histogram", nil, "l"), 0.5, map[string]string{"trace_id": "abc123"}, "a")
+
+	assert.Equal(t, 0.5, m.value("histogram_seconds", "a"))
+}
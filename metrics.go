@@ -2,55 +2,185 @@ package app
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
+// PrometheusConfig holds configuration for the app's Prometheus metrics.
+// Setting PushGateway to the URL of a Prometheus Pushgateway pushes the
+// metrics every PushInterval, and once more when the app stops, for batch
+// jobs and other short-lived apps that would not otherwise be scraped.
+// ConstLabels are added to every metric created through Metrics, in addition
+// to the env and version labels added by NewApp.
+//
+// Metric names are Prefix and the name joined by an underscore, or just the
+// name when there is no prefix. LegacyNames restores the app label that earlier
+// versions added to every metric, and the SQS processing counters they
+// emitted, so that existing dashboards keep working while they are migrated.
 type PrometheusConfig struct {
-	Enabled bool
-	Path    string `default:"/metrics"`
-	Port    int    `default:"9090"`
-	Prefix  string
+	Enabled      bool              `desc:"Serve the Prometheus metrics endpoint"`
+	Path         string            `default:"/metrics" desc:"Path of the metrics endpoint"`
+	Port         int               `default:"9090" validate:"min=1,max=65535" desc:"Port of the metrics endpoint"`
+	Prefix       string            `desc:"Prefix of metric names"`
+	PushGateway  string            `validate:"url" desc:"URL of a Pushgateway to push metrics to"`
+	PushInterval time.Duration     `default:"15s" desc:"Interval between pushes to the Pushgateway"`
+	ConstLabels  map[string]string `desc:"Labels added to every metric, e.g. region:eu"`
+	LegacyNames  bool              `desc:"Add the app label and SQS processing counters of earlier versions"`
 }
 
 func NewMetrics(config PrometheusConfig) *Metrics {
 	r := prometheus.NewRegistry()
-	r.MustRegister(prometheus.NewBuildInfoCollector())
-	r.MustRegister(prometheus.NewGoCollector())
+	r.MustRegister(collectors.NewBuildInfoCollector())
+	r.MustRegister(collectors.NewGoCollector())
+	r.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
 	return &Metrics{
-		prefix:   config.Prefix,
-		registry: r,
+		prefix:     config.Prefix,
+		registry:   r,
+		registerer: prometheus.WrapRegistererWith(config.ConstLabels, r),
 	}
 }
 
+// Metrics creates and registers the app's Prometheus metrics. Creating a
+// metric that has already been registered returns the existing metric.
 type Metrics struct {
-	prefix   string
-	registry *prometheus.Registry
+	prefix     string
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+}
+
+// HistogramOption configures a histogram created by Metrics.
+type HistogramOption func(opts *prometheus.HistogramOpts)
+
+// WithBuckets sets the upper bounds of the histogram's buckets in place of
+// prometheus.DefBuckets, e.g. using prometheus.ExponentialBuckets.
+func WithBuckets(buckets []float64) HistogramOption {
+	return func(opts *prometheus.HistogramOpts) {
+		opts.Buckets = buckets
+	}
 }
 
 func (m Metrics) NewCounterVec(name string, help string, labelNames []string) *prometheus.CounterVec {
 	c := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: fmt.Sprintf("%s_%s", m.prefix, name),
+		Name: m.fullName(name),
 		Help: help,
 	}, labelNames)
 
-	m.registry.MustRegister(c)
+	return m.register(c).(*prometheus.CounterVec)
+}
 
-	return c
+func (m Metrics) NewGauge(name string, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: m.fullName(name),
+		Help: help,
+	})
+
+	return m.register(g).(prometheus.Gauge)
 }
 
-func (m Metrics) NewHistogramVec(name string, help string, labelNames []string) *prometheus.HistogramVec {
-	c := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: fmt.Sprintf("%s_%s", m.prefix, name),
+func (m Metrics) NewGaugeVec(name string, help string, labelNames []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: m.fullName(name),
 		Help: help,
 	}, labelNames)
 
-	m.registry.MustRegister(c)
+	return m.register(g).(*prometheus.GaugeVec)
+}
+
+// NewGaugeFunc creates a gauge whose value is obtained by calling f whenever
+// the metrics are collected.
+func (m Metrics) NewGaugeFunc(name string, help string, f func() float64) prometheus.GaugeFunc {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: m.fullName(name),
+		Help: help,
+	}, f)
+
+	return m.register(g).(prometheus.GaugeFunc)
+}
+
+func (m Metrics) NewHistogramVec(name string, help string, labelNames []string, opts ...HistogramOption) *prometheus.HistogramVec {
+	histogramOpts := prometheus.HistogramOpts{
+		Name: m.fullName(name),
+		Help: help,
+	}
+
+	for _, opt := range opts {
+		opt(&histogramOpts)
+	}
+
+	c := prometheus.NewHistogramVec(histogramOpts, labelNames)
+
+	return m.register(c).(*prometheus.HistogramVec)
+}
+
+// NewSummaryVec creates a summary reporting the quantiles in objectives, a map
+// of quantile to its allowed absolute error, e.g. {0.5: 0.05, 0.99: 0.001}.
+func (m Metrics) NewSummaryVec(name string, help string, labelNames []string, objectives map[float64]float64) *prometheus.SummaryVec {
+	s := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       m.fullName(name),
+		Help:       help,
+		Objectives: objectives,
+	}, labelNames)
+
+	return m.register(s).(*prometheus.SummaryVec)
+}
+
+// register registers c, returning the existing collector instead if an
+// identical one has already been registered.
+func (m Metrics) register(c prometheus.Collector) prometheus.Collector {
+	if err := m.registerer.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
 
 	return c
 }
 
+func (m Metrics) fullName(name string) string {
+	return metricName(m.prefix, name)
+}
+
+// registerAppInfo registers the app_info metric describing the build of the
+// app and the app_uptime_seconds metric. Like the Go runtime and process
+// metrics, they are not prefixed.
+func (m Metrics) registerAppInfo(info VersionInfo) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "app_info",
+		Help:        "Build information about the app, always 1.",
+		ConstLabels: prometheus.Labels{"version": info.Version, "commit": info.Commit, "env": info.Env},
+	}, func() float64 { return 1 }))
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "app_uptime_seconds",
+		Help: "The time in seconds since the app started.",
+	}, func() float64 { return time.Since(info.StartTime).Seconds() }))
+}
+
+// appConstLabels returns the labels added to every metric of the app.
+func appConstLabels(config AppConfig) prometheus.Labels {
+	labels := prometheus.Labels{
+		"env": config.Env,
+	}
+
+	if config.Prometheus.LegacyNames {
+		labels["app"] = config.Name
+	}
+
+	if config.Version != "" {
+		labels["version"] = config.Version
+	}
+
+	for k, v := range config.Prometheus.ConstLabels {
+		labels[k] = v
+	}
+
+	return labels
+}
+
 func metricName(prefix, name string) string {
 	if prefix == "" {
 		return name
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// newPusher returns a Pusher for the app's metrics, grouped by the app's
+// name as the job and its environment. The Pushgateway rejects metrics with a
+// label that is also in the grouping key, so the env const label is removed
+// from the pushed metrics.
+func (a *App) newPusher() *push.Pusher {
+	return push.New(a.config.Prometheus.PushGateway, a.config.Name).
+		Grouping("env", a.config.Env).
+		Gatherer(withoutLabel(a.Metrics.registry, "env"))
+}
+
+// withoutLabel returns a Gatherer of copies of the metrics gathered by g,
+// without the label name. The gathered metrics are copied as collectors may
+// reuse them.
+func withoutLabel(g prometheus.Gatherer, name string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+
+		for i, mf := range mfs {
+			mf = proto.Clone(mf).(*dto.MetricFamily)
+			mfs[i] = mf
+			for _, m := range mf.Metric {
+				labels := m.Label[:0]
+				for _, l := range m.Label {
+					if l.GetName() != name {
+						labels = append(labels, l)
+					}
+				}
+				m.Label = labels
+			}
+		}
+
+		return mfs, err
+	})
+}
+
+// pushMetrics pushes the app's metrics to the configured Pushgateway,
+// replacing any previously pushed for the same grouping key.
+func (a *App) pushMetrics() {
+	if a.config.Prometheus.PushGateway == "" {
+		return
+	}
+
+	if err := a.newPusher().Push(); err != nil {
+		a.logger.Error().Err(err).Str("url", a.config.Prometheus.PushGateway).Msg("Failed to push metrics")
+		return
+	}
+
+	a.logger.Debug().Str("url", a.config.Prometheus.PushGateway).Msg("Pushed metrics")
+}
+
+// startMetricsPusher periodically pushes the app's metrics until ctx is done.
+// It is not tracked by the app's wait group so that short-lived apps can
+// finish when their tasks complete.
+func (a *App) startMetricsPusher(ctx context.Context) {
+	if a.config.Prometheus.PushGateway == "" || a.config.Prometheus.PushInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.config.Prometheus.PushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.pushMetrics()
+			}
+		}
+	}()
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pushGatewayStub struct {
+	mu     sync.Mutex
+	pushes []string
+	bodies []string
+}
+
+func (s *pushGatewayStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pushes = append(s.pushes, r.Method+" "+r.URL.Path)
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *pushGatewayStub) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pushes)
+}
+
+func newPushApp(t *testing.T, url string, interval string) *App {
+	os.Setenv("MY_APP_PROMETHEUS_PUSHGATEWAY", url)
+	os.Setenv("MY_APP_PROMETHEUS_PUSHINTERVAL", interval)
+	os.Setenv("MY_APP_ENV", "test")
+	t.Cleanup(func() {
+		os.Unsetenv("MY_APP_PROMETHEUS_PUSHGATEWAY")
+		os.Unsetenv("MY_APP_PROMETHEUS_PUSHINTERVAL")
+		os.Unsetenv("MY_APP_ENV")
+	})
+
+	return NewApp(NewAppConfig("MyApp").WithMetrics("my_app"))
+}
+
+func TestPushMetrics(t *testing.T) {
+	stub := &pushGatewayStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	app := newPushApp(t, server.URL, "15s")
+	app.Metrics.NewCounterVec("foo_total", "Foo", []string{"bar"}).WithLabelValues("baz").Inc()
+
+	app.pushMetrics()
+
+	require.Equal(t, 1, stub.count())
+	assert.Equal(t, "PUT /metrics/job/MyApp/env/test", stub.pushes[0])
+	assert.Contains(t, stub.bodies[0], "my_app_foo_total")
+}
+
+func TestWithoutLabel(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{ConstLabels: map[string]string{"env": "test", "version": "1.2.3"}})
+	m.NewCounterVec("foo_total", "Foo", []string{"bar"}).WithLabelValues("baz").Inc()
+
+	mfs, err := withoutLabel(m.registry, "env").Gather()
+	require.NoError(t, err)
+
+	for _, mf := range mfs {
+		if mf.GetName() != "foo_total" {
+			continue
+		}
+		var names []string
+		for _, l := range mf.Metric[0].Label {
+			names = append(names, l.GetName())
+		}
+		assert.Equal(t, []string{"bar", "version"}, names)
+		return
+	}
+	t.Fatal("foo_total not gathered")
+}
+
+func TestPushMetricsNotConfigured(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	assert.NotPanics(t, app.pushMetrics)
+}
+
+func TestMetricsPusherPushesPeriodically(t *testing.T) {
+	stub := &pushGatewayStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	app := newPushApp(t, server.URL, "10ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.startMetricsPusher(ctx)
+
+	assert.Eventually(t, func() bool { return stub.count() >= 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestStartPushesMetricsWhenTasksComplete(t *testing.T) {
+	stub := &pushGatewayStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	app := newPushApp(t, server.URL, "1h")
+	app.AddTaskFunc(func(ctx context.Context, logger zerolog.Logger) {})
+
+	app.Start()
+
+	assert.Equal(t, 1, stub.count(), "metrics should be pushed once when the app finishes")
+}
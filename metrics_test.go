@@ -1,9 +1,13 @@
 package app
 
 import (
+	"os"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewMetrics(t *testing.T) {
@@ -16,3 +20,149 @@ func TestMetricName(t *testing.T) {
 	assert.Equal(t, "bar", metricName("", "bar"))
 	assert.Equal(t, "foo_bar", metricName("foo", "bar"))
 }
+
+func TestMetricsConstructors(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo"})
+
+	m.NewCounterVec("counter_total", "A counter", []string{"l"}).WithLabelValues("a").Inc()
+	m.NewGauge("gauge", "A gauge").Set(2)
+	m.NewGaugeVec("gauge_vec", "A gauge vec", []string{"l"}).WithLabelValues("a").Set(3)
+	m.NewGaugeFunc("gauge_func", "A gauge func", func() float64 { return 4 })
+	m.NewHistogramVec("histogram_seconds", "A histogram", []string{"l"}).WithLabelValues("a").Observe(1)
+	m.NewSummaryVec("summary_seconds", "A summary", []string{"l"}, map[float64]float64{0.5: 0.05}).WithLabelValues("a").Observe(1)
+
+	mfs := gatherMetrics(t, m)
+
+	testCases := []struct {
+		name       string
+		metricType dto.MetricType
+	}{
+		{name: "foo_counter_total", metricType: dto.MetricType_COUNTER},
+		{name: "foo_gauge", metricType: dto.MetricType_GAUGE},
+		{name: "foo_gauge_vec", metricType: dto.MetricType_GAUGE},
+		{name: "foo_gauge_func", metricType: dto.MetricType_GAUGE},
+		{name: "foo_histogram_seconds", metricType: dto.MetricType_HISTOGRAM},
+		{name: "foo_summary_seconds", metricType: dto.MetricType_SUMMARY},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Contains(t, mfs, tc.name)
+			assert.Equal(t, tc.metricType, mfs[tc.name].GetType())
+		})
+	}
+
+	assert.Equal(t, 4.0, mfs["foo_gauge_func"].GetMetric()[0].GetGauge().GetValue())
+}
+
+func TestMetricsRegisterTwice(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo"})
+
+	c1 := m.NewCounterVec("counter_total", "A counter", []string{"l"})
+	c2 := m.NewCounterVec("counter_total", "A counter", []string{"l"})
+	assert.Same(t, c1, c2)
+
+	g1 := m.NewGauge("gauge", "A gauge")
+	g2 := m.NewGauge("gauge", "A gauge")
+	assert.Equal(t, g1, g2)
+
+	assert.Panics(t, func() {
+		m.NewCounterVec("counter_total", "A counter", []string{"other"})
+	})
+}
+
+func TestMetricsWithBuckets(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo"})
+
+	m.NewHistogramVec("histogram_seconds", "A histogram", []string{"l"}, WithBuckets([]float64{0.1, 1, 10})).WithLabelValues("a").Observe(0.5)
+
+	mfs := gatherMetrics(t, m)
+	buckets := mfs["foo_histogram_seconds"].GetMetric()[0].GetHistogram().GetBucket()
+
+	require.Len(t, buckets, 3)
+	assert.Equal(t, 0.1, buckets[0].GetUpperBound())
+	assert.Equal(t, uint64(0), buckets[0].GetCumulativeCount())
+	assert.Equal(t, 1.0, buckets[1].GetUpperBound())
+	assert.Equal(t, uint64(1), buckets[1].GetCumulativeCount())
+}
+
+func TestMetricsConstLabels(t *testing.T) {
+	m := NewMetrics(PrometheusConfig{Prefix: "foo", ConstLabels: map[string]string{"region": "eu"}})
+
+	m.NewGauge("gauge", "A gauge").Set(1)
+
+	mfs := gatherMetrics(t, m)
+
+	assert.Equal(t, prometheus.Labels{"region": "eu"}, metricLabels(mfs["foo_gauge"].GetMetric()[0]))
+}
+
+func TestNewAppConstLabels(t *testing.T) {
+	os.Setenv("MY_APP_ENV", "test")
+	defer os.Unsetenv("MY_APP_ENV")
+	os.Setenv("MY_APP_VERSION", "1.2.3")
+	defer os.Unsetenv("MY_APP_VERSION")
+	os.Setenv("MY_APP_PROMETHEUS_CONSTLABELS", "region:eu")
+	defer os.Unsetenv("MY_APP_PROMETHEUS_CONSTLABELS")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.Metrics.NewGauge("gauge", "A gauge").Set(1)
+
+	mfs := gatherMetrics(t, app.Metrics)
+
+	assert.Equal(t, prometheus.Labels{"env": "test", "version": "1.2.3", "region": "eu"}, metricLabels(mfs["gauge"].GetMetric()[0]))
+}
+
+func TestNewAppLegacyNames(t *testing.T) {
+	os.Setenv("MY_APP_PROMETHEUS_LEGACYNAMES", "true")
+	defer os.Unsetenv("MY_APP_PROMETHEUS_LEGACYNAMES")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.Metrics.NewGauge("gauge", "A gauge").Set(1)
+
+	mfs := gatherMetrics(t, app.Metrics)
+
+	require.Contains(t, mfs, "gauge")
+	assert.Equal(t, prometheus.Labels{"app": "MyApp", "env": "dev"}, metricLabels(mfs["gauge"].GetMetric()[0]))
+}
+
+func TestMetricsFullName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config PrometheusConfig
+		out    string
+	}{
+		{name: "no prefix", config: PrometheusConfig{}, out: "bar"},
+		{name: "prefix", config: PrometheusConfig{Prefix: "foo"}, out: "foo_bar"},
+		{name: "legacy no prefix", config: PrometheusConfig{LegacyNames: true}, out: "bar"},
+		{name: "legacy prefix", config: PrometheusConfig{Prefix: "foo", LegacyNames: true}, out: "foo_bar"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, NewMetrics(tc.config).fullName("bar"))
+		})
+	}
+}
+
+func gatherMetrics(t *testing.T, m *Metrics) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	gathered, err := m.registry.Gather()
+	require.NoError(t, err)
+
+	mfs := map[string]*dto.MetricFamily{}
+	for _, mf := range gathered {
+		mfs[mf.GetName()] = mf
+	}
+
+	return mfs
+}
+
+func metricLabels(metric *dto.Metric) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for _, l := range metric.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	return labels
+}
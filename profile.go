@@ -0,0 +1,138 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+)
+
+// Environments with a profile of defaults. The environment is set by the Env
+// configuration, e.g. MY_APP_ENV=prod or --env=prod.
+const (
+	EnvDev     = "dev"
+	EnvTest    = "test"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// profiles holds the configuration defaults of each environment, keyed by the
+// key path of the configuration. They take precedence over the defaults in
+// struct tags, but are overridden by the config file, environment variables
+// and flags. Apps can change them with AppConfig.WithProfile, e.g. to log in
+// the console format in dev. The admin endpoints are not authenticated, so no
+// profile enables them.
+var profiles = map[string]map[string]string{
+	EnvDev: {
+		"log.level": "debug",
+	},
+	EnvTest: {
+		"log.level": "warn",
+	},
+	EnvStaging: {
+		"log.level":          "info",
+		"prometheus.enabled": "true",
+	},
+	EnvProd: {
+		"log.level":          "warn",
+		"log.format":         "json",
+		"admin.enabled":      "false",
+		"prometheus.enabled": "true",
+	},
+}
+
+// WithProfile sets configuration defaults for the environment env, e.g.
+// {"log.level": "info"}, in addition to or in place of those of the built-in
+// profiles. Keys are key paths, as used in the config file and flags.
+func (c AppConfig) WithProfile(env string, defaults map[string]string) AppConfig {
+	p := make(map[string]map[string]string, len(c.profiles)+1)
+	for k, v := range c.profiles {
+		p[k] = v
+	}
+
+	merged := make(map[string]string)
+	for k, v := range p[env] {
+		merged[k] = v
+	}
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	p[env] = merged
+
+	c.profiles = p
+
+	return c
+}
+
+// profileDefaults returns the configuration defaults of the environment env,
+// keyed by normalised key path.
+func (c AppConfig) profileDefaults(env string) map[string]string {
+	defaults := make(map[string]string)
+
+	for _, p := range []map[string]string{profiles[env], c.profiles[env]} {
+		for k, v := range p {
+			defaults[strings.Join(configKeyPath(strings.Split(k, ".")), ".")] = v
+		}
+	}
+
+	return defaults
+}
+
+// profileEnv returns the environment the app is starting in, from the env
+// flag in flags or the environment variable of the app with envPrefix, e.g.
+// MY_APP_ENV.
+// It is known before .env files are loaded so that those of the environment
+// can be chosen, and defaults to dev.
+func profileEnv(envPrefix string, flags map[string]string) string {
+	if env, ok := flags["env"]; ok {
+		return env
+	}
+
+	if env := os.Getenv(envPrefix + "_ENV"); env != "" {
+		return env
+	}
+
+	return EnvDev
+}
+
+// loadDotenvFiles loads environment variables from the .env.<env> and .env
+// files that exist, with those in .env.<env> taking precedence. Variables
+// already set in the environment are not overridden. The .env file holds
+// local development settings, so it is ignored in prod. It returns the files
+// loaded.
+func loadDotenvFiles(env string, logger zerolog.Logger) ([]string, error) {
+	candidates := []string{".env." + env}
+	if env == EnvProd {
+		if _, err := os.Stat(".env"); err == nil {
+			logger.Warn().Msg("Ignoring .env file in prod environment")
+		}
+	} else {
+		candidates = append(candidates, ".env")
+	}
+
+	var files []string
+	for _, f := range candidates {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	return files, godotenv.Load(files...)
+}
+
+// checkProdDotenv returns an error if the app is running in prod but the
+// environment was not prod when .env files were chosen, such as when prod is
+// set in a .env file, so that development settings are not used in prod.
+func checkProdDotenv(env string, profile string, dotenvFiles []string) error {
+	if env == EnvProd && profile != EnvProd && len(dotenvFiles) > 0 {
+		return errors.New("prod environment must be set before .env files are loaded, in the process environment or flags")
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileDefaults(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config AppConfig
+		env    string
+		out    map[string]string
+	}{
+		{name: "dev", env: EnvDev, out: map[string]string{"log.level": "debug"}},
+		{name: "prod", env: EnvProd, out: map[string]string{"log.level": "warn", "log.format": "json", "admin.enabled": "false", "prometheus.enabled": "true"}},
+		{name: "unknown", env: "qa", out: map[string]string{}},
+		{name: "added", config: AppConfig{}.WithProfile(EnvDev, map[string]string{"Log.Format": "console"}), env: EnvDev, out: map[string]string{"log.level": "debug", "log.format": "console"}},
+		{name: "overridden", config: AppConfig{}.WithProfile(EnvDev, map[string]string{"log.level": "info"}), env: EnvDev, out: map[string]string{"log.level": "info"}},
+		{name: "new env", config: AppConfig{}.WithProfile("qa", map[string]string{"tracing.enabled": "true"}), env: "qa", out: map[string]string{"tracing.enabled": "true"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, tc.config.profileDefaults(tc.env))
+		})
+	}
+}
+
+func TestProfileEnv(t *testing.T) {
+	assert.Equal(t, EnvDev, profileEnv("MY_APP", nil))
+	assert.Equal(t, EnvTest, profileEnv("MY_APP", map[string]string{"env": EnvTest}))
+
+	os.Setenv("MY_APP_ENV", EnvStaging)
+	defer os.Unsetenv("MY_APP_ENV")
+
+	assert.Equal(t, EnvStaging, profileEnv("MY_APP", nil))
+	assert.Equal(t, EnvTest, profileEnv("MY_APP", map[string]string{"env": EnvTest}))
+}
+
+func TestNewAppProfiles(t *testing.T) {
+	testCases := []struct {
+		name          string
+		env           map[string]string
+		args          []string
+		outEnv        string
+		outLevel      zerolog.Level
+		outPrometheus bool
+		outAdmin      bool
+	}{
+		{name: "default", outEnv: EnvDev, outLevel: zerolog.DebugLevel},
+		{name: "test", env: map[string]string{"MY_APP_ENV": EnvTest}, outEnv: EnvTest, outLevel: zerolog.WarnLevel},
+		{name: "staging", env: map[string]string{"MY_APP_ENV": EnvStaging}, outEnv: EnvStaging, outLevel: zerolog.InfoLevel, outPrometheus: true},
+		{name: "staging admin", env: map[string]string{"MY_APP_ENV": EnvStaging}, args: []string{"--admin.enabled"}, outEnv: EnvStaging, outLevel: zerolog.InfoLevel, outPrometheus: true, outAdmin: true},
+		{name: "prod flag", args: []string{"--env=prod"}, outEnv: EnvProd, outLevel: zerolog.WarnLevel, outPrometheus: true},
+		{name: "overridden", env: map[string]string{"MY_APP_ENV": EnvProd, "MY_APP_LOG_LEVEL": "error", "MY_APP_PROMETHEUS_ENABLED": "false"}, outEnv: EnvProd, outLevel: zerolog.ErrorLevel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			app := NewApp(NewAppConfig("MyApp").WithArgs(tc.args...).Build())
+
+			assert.Equal(t, tc.outEnv, app.config.Env)
+			assert.Equal(t, tc.outLevel, app.logLevels.app.Level())
+			assert.Equal(t, tc.outPrometheus, app.config.Prometheus.Enabled)
+			assert.Equal(t, tc.outAdmin, app.config.Admin.Enabled)
+		})
+	}
+}
+
+func TestNewAppProfileFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("env: staging\n"), 0o600))
+	os.Setenv("MY_APP_CONFIG_FILE", path)
+	defer os.Unsetenv("MY_APP_CONFIG_FILE")
+
+	app := NewApp(NewAppConfig("MyApp").WithArgs().Build())
+
+	assert.Equal(t, EnvStaging, app.config.Env)
+	assert.Equal(t, zerolog.InfoLevel, app.logLevels.app.Level())
+	assert.True(t, app.config.Prometheus.Enabled)
+}
+
+func chdirTemp(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLoadDotenvFiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      string
+		outFiles []string
+		outVars  map[string]string
+	}{
+		{name: "staging", env: EnvStaging, outFiles: []string{".env.staging", ".env"}, outVars: map[string]string{"DOTENV_A": "staging", "DOTENV_B": "base"}},
+		{name: "no profile file", env: EnvTest, outFiles: []string{".env"}, outVars: map[string]string{"DOTENV_A": "base", "DOTENV_B": "base"}},
+		{name: "prod ignores .env", env: EnvProd, outFiles: []string{".env.prod"}, outVars: map[string]string{"DOTENV_A": "prod", "DOTENV_B": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chdirTemp(t, map[string]string{
+				".env":         "DOTENV_A=base\nDOTENV_B=base\n",
+				".env.staging": "DOTENV_A=staging\n",
+				".env.prod":    "DOTENV_A=prod\n",
+			})
+			defer os.Unsetenv("DOTENV_A")
+			defer os.Unsetenv("DOTENV_B")
+
+			files, err := loadDotenvFiles(tc.env, zerolog.Nop())
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.outFiles, files)
+			for k, v := range tc.outVars {
+				assert.Equal(t, v, os.Getenv(k), k)
+			}
+		})
+	}
+}
+
+func TestCheckProdDotenv(t *testing.T) {
+	testCases := []struct {
+		name        string
+		env         string
+		profile     string
+		dotenvFiles []string
+		outErr      bool
+	}{
+		{name: "dev with .env", env: EnvDev, profile: EnvDev, dotenvFiles: []string{".env"}},
+		{name: "prod from environment", env: EnvProd, profile: EnvProd, dotenvFiles: []string{".env.prod"}},
+		{name: "prod from config file", env: EnvProd, profile: EnvDev},
+		{name: "prod from .env", env: EnvProd, profile: EnvDev, dotenvFiles: []string{".env"}, outErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkProdDotenv(tc.env, tc.profile, tc.dotenvFiles)
+			assert.Equal(t, tc.outErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/rs/zerolog"
+)
+
+// Schemes of configuration values referring to secrets, e.g.
+// ssm:///path/to/param or secretsmanager://name#jsonKey.
+const (
+	SSMScheme            = "ssm://"
+	SecretsManagerScheme = "secretsmanager://"
+)
+
+// SecretsConfig holds configuration for resolving secret references in
+// configuration values. Resolved secrets are cached for CacheTTL, and Secret
+// fields are refreshed every RefreshInterval if it is set.
+type SecretsConfig struct {
+	CacheTTL        time.Duration `default:"5m" desc:"Time resolved secrets are cached for"`
+	RefreshInterval time.Duration `desc:"Interval between refreshes of Secret values, if set"`
+}
+
+// Secret holds a configuration value resolved from a secret reference. Unlike
+// a string field, which is resolved once when the configuration is read, a
+// Secret is kept up to date when periodic refresh is enabled. Secret values
+// can also be given directly, e.g. for local development.
+type Secret struct {
+	v *secretValue
+}
+
+type secretValue struct {
+	mu    sync.RWMutex
+	value string
+}
+
+// NewSecret returns a Secret holding value.
+func NewSecret(value string) Secret {
+	return Secret{v: &secretValue{value: value}}
+}
+
+// Value returns the current value of the secret.
+func (s Secret) Value() string {
+	if s.v == nil {
+		return ""
+	}
+
+	s.v.mu.RLock()
+	defer s.v.mu.RUnlock()
+
+	return s.v.value
+}
+
+// String hides the value of the secret, so that it is not logged by accident.
+func (s Secret) String() string {
+	return redacted
+}
+
+// Decode sets the value of the secret, as given in the configuration. It
+// always replaces the secret's value rather than changing it, as copies of a
+// config struct share the value of their Secret fields.
+func (s *Secret) Decode(value string) error {
+	s.v = &secretValue{value: value}
+
+	return nil
+}
+
+func (s Secret) set(value string) {
+	s.v.mu.Lock()
+	defer s.v.mu.Unlock()
+
+	s.v.value = value
+}
+
+var secretType = reflect.TypeOf(Secret{})
+
+// secretResolver resolves secret references through SSM Parameter Store and
+// Secrets Manager, creating the clients from the app's AWS session when first
+// needed.
+type secretResolver struct {
+	session func() *session.Session
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	ssm     ssmiface.SSMAPI
+	sm      secretsmanageriface.SecretsManagerAPI
+	cache   map[string]cachedSecret
+	secrets map[string]Secret
+}
+
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+func newSecretResolver(sess func() *session.Session) *secretResolver {
+	return &secretResolver{
+		session: sess,
+		now:     time.Now,
+		cache:   make(map[string]cachedSecret),
+		secrets: make(map[string]Secret),
+	}
+}
+
+// isSecretRef reports whether s is a reference to a secret.
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, SSMScheme) || strings.HasPrefix(s, SecretsManagerScheme)
+}
+
+// secretRef returns the reference to the secret in value, where store, from
+// the secret tag of its field, names the store of values without a scheme.
+func secretRef(value string, store string) (string, error) {
+	if value == "" || isSecretRef(value) {
+		return value, nil
+	}
+
+	switch store {
+	case "":
+		return value, nil
+	case "ssm":
+		return SSMScheme + value, nil
+	case "secretsmanager":
+		return SecretsManagerScheme + value, nil
+	default:
+		return "", fmt.Errorf("unknown secret store %q", store)
+	}
+}
+
+// resolve returns the value of the secret referred to by ref, from the cache
+// if it was fetched within the cache TTL.
+func (r *secretResolver) resolve(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	c, ok := r.cache[ref]
+	r.mu.Unlock()
+
+	if ok && r.now().Sub(c.fetched) < r.ttl {
+		return c.value, nil
+	}
+
+	return r.fetch(ctx, ref)
+}
+
+// fetch fetches the value of the secret referred to by ref, updating the cache.
+func (r *secretResolver) fetch(ctx context.Context, ref string) (string, error) {
+	var value string
+	var err error
+
+	switch {
+	case strings.HasPrefix(ref, SSMScheme):
+		value, err = r.fetchParameter(ctx, strings.TrimPrefix(ref, SSMScheme))
+	case strings.HasPrefix(ref, SecretsManagerScheme):
+		value, err = r.fetchSecret(ctx, strings.TrimPrefix(ref, SecretsManagerScheme))
+	default:
+		err = fmt.Errorf("not a secret reference")
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving secret %q: %w", ref, err)
+	}
+
+	r.mu.Lock()
+	r.cache[ref] = cachedSecret{value: value, fetched: r.now()}
+	r.mu.Unlock()
+
+	return value, nil
+}
+
+func (r *secretResolver) fetchParameter(ctx context.Context, name string) (string, error) {
+	out, err := r.ssmClient().GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.Parameter.Value), nil
+}
+
+// fetchSecret fetches the secret named by ref, of the form name or name#key,
+// where key selects a field of a secret holding a JSON object.
+func (r *secretResolver) fetchSecret(ctx context.Context, ref string) (string, error) {
+	name, key, hasKey := strings.Cut(ref, "#")
+
+	out, err := r.secretsManagerClient().GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.StringValue(out.SecretString)
+	if !hasKey {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("parsing secret as JSON: %w", err)
+	}
+
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret", key)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+
+	return configScalarString(field), nil
+}
+
+func (r *secretResolver) ssmClient() ssmiface.SSMAPI {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ssm == nil {
+		r.ssm = ssm.New(r.session())
+	}
+
+	return r.ssm
+}
+
+func (r *secretResolver) secretsManagerClient() secretsmanageriface.SecretsManagerAPI {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sm == nil {
+		r.sm = secretsmanager.New(r.session())
+	}
+
+	return r.sm
+}
+
+// resolveField resolves the secret reference in v, a string or Secret field
+// of configuration, registering Secret fields for refresh. It reports whether
+// v held a secret reference.
+func (r *secretResolver) resolveField(v reflect.Value, store string) (bool, error) {
+	var value string
+	switch {
+	case v.Kind() == reflect.String:
+		value = v.String()
+	case v.Type() == secretType:
+		value = v.Interface().(Secret).Value()
+	default:
+		return false, nil
+	}
+
+	ref, err := secretRef(value, store)
+	if err != nil || !isSecretRef(ref) {
+		return false, err
+	}
+
+	resolved, err := r.resolve(context.Background(), ref)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Kind() == reflect.String {
+		v.SetString(resolved)
+		return true, nil
+	}
+
+	// Fields referring to the same secret share its value, so that reading a
+	// struct again, e.g. on reload, does not register it for refreshing twice.
+	r.mu.Lock()
+	secret, ok := r.secrets[ref]
+	if !ok {
+		secret = v.Interface().(Secret)
+		r.secrets[ref] = secret
+	}
+	r.mu.Unlock()
+
+	secret.set(resolved)
+	v.Set(reflect.ValueOf(secret))
+
+	return true, nil
+}
+
+// refresh fetches the current value of every Secret field.
+func (r *secretResolver) refresh(ctx context.Context, logger zerolog.Logger) {
+	r.mu.Lock()
+	secrets := make(map[string]Secret, len(r.secrets))
+	for ref, s := range r.secrets {
+		secrets[ref] = s
+	}
+	r.mu.Unlock()
+
+	for ref, s := range secrets {
+		value, err := r.fetch(ctx, ref)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to refresh secret")
+			continue
+		}
+		s.set(value)
+	}
+}
+
+// startSecretsRefresh periodically refreshes the app's Secret fields until
+// ctx is done.
+func (a *App) startSecretsRefresh(ctx context.Context) {
+	if a.config.Secrets.RefreshInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.config.Secrets.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.configLayers.secrets.refresh(ctx, a.logger)
+			}
+		}
+	}()
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSSMClient struct {
+	ssmiface.SSMAPI
+	params map[string]string
+	calls  int
+}
+
+func (m *mockSSMClient) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, options ...request.Option) (*ssm.GetParameterOutput, error) {
+	m.calls++
+	value, ok := m.params[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, errors.New("parameter not found")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+type mockSecretsManagerClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+	calls   int
+}
+
+func (m *mockSecretsManagerClient) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	m.calls++
+	value, ok := m.secrets[aws.StringValue(input.SecretId)]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func newTestSecretResolver() (*secretResolver, *mockSSMClient, *mockSecretsManagerClient) {
+	ssmClient := &mockSSMClient{params: map[string]string{"/db/password": "hunter2"}}
+	smClient := &mockSecretsManagerClient{secrets: map[string]string{
+		"api":   `{"key": "abc123", "port": 5432}`,
+		"plain": "plain-secret",
+	}}
+
+	r := newSecretResolver(nil)
+	r.ssm = ssmClient
+	r.sm = smClient
+	r.ttl = time.Minute
+
+	return r, ssmClient, smClient
+}
+
+func TestSecretResolverResolve(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ref      string
+		outValue string
+		outErr   bool
+	}{
+		{name: "ssm", ref: "ssm:///db/password", outValue: "hunter2"},
+		{name: "ssm missing", ref: "ssm:///missing", outErr: true},
+		{name: "secrets manager", ref: "secretsmanager://plain", outValue: "plain-secret"},
+		{name: "secrets manager key", ref: "secretsmanager://api#key", outValue: "abc123"},
+		{name: "secrets manager number key", ref: "secretsmanager://api#port", outValue: "5432"},
+		{name: "secrets manager missing key", ref: "secretsmanager://api#missing", outErr: true},
+		{name: "secrets manager not json", ref: "secretsmanager://plain#key", outErr: true},
+		{name: "secrets manager missing", ref: "secretsmanager://missing", outErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _, _ := newTestSecretResolver()
+
+			value, err := r.resolve(context.TODO(), tc.ref)
+
+			if tc.outErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.ref)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.outValue, value)
+		})
+	}
+}
+
+func TestSecretResolverCache(t *testing.T) {
+	r, ssmClient, _ := newTestSecretResolver()
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		value, err := r.resolve(context.TODO(), "ssm:///db/password")
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", value)
+	}
+	assert.Equal(t, 1, ssmClient.calls)
+
+	now = now.Add(2 * time.Minute)
+	_, err := r.resolve(context.TODO(), "ssm:///db/password")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ssmClient.calls)
+}
+
+func TestSecretRef(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		store  string
+		out    string
+		outErr bool
+	}{
+		{name: "empty", value: "", store: "ssm", out: ""},
+		{name: "plain", value: "hunter2", store: "", out: "hunter2"},
+		{name: "reference", value: "ssm:///db/password", store: "", out: "ssm:///db/password"},
+		{name: "ssm tag", value: "/db/password", store: "ssm", out: "ssm:///db/password"},
+		{name: "secrets manager tag", value: "api#key", store: "secretsmanager", out: "secretsmanager://api#key"},
+		{name: "reference with tag", value: "secretsmanager://api", store: "ssm", out: "secretsmanager://api"},
+		{name: "unknown store", value: "foo", store: "vault", outErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := secretRef(tc.value, tc.store)
+
+			if tc.outErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+}
+
+func TestConfigLayersResolvesSecrets(t *testing.T) {
+	r, _, _ := newTestSecretResolver()
+	l := testConfigLayers(nil, map[string]string{
+		"MY_APP_PASSWORD": "ssm:///db/password",
+		"MY_APP_APIKEY":   "api#key",
+		"MY_APP_TOKEN":    "secretsmanager://plain",
+		"MY_APP_PLAIN":    "not-a-secret",
+	})
+	l.secrets = r
+
+	c := &struct {
+		Password string
+		APIKey   Secret `secret:"secretsmanager"`
+		Token    Secret
+		Plain    Secret
+		Unset    Secret
+	}{}
+	require.NoError(t, l.load(c, "MY_APP", nil))
+
+	assert.Equal(t, "hunter2", c.Password)
+	assert.Equal(t, "abc123", c.APIKey.Value())
+	assert.Equal(t, "plain-secret", c.Token.Value())
+	assert.Equal(t, "not-a-secret", c.Plain.Value())
+	assert.Equal(t, "", c.Unset.Value())
+	assert.Len(t, r.secrets, 2)
+}
+
+func TestConfigLayersSecretError(t *testing.T) {
+	r, _, _ := newTestSecretResolver()
+	l := testConfigLayers(nil, map[string]string{"MY_APP_PASSWORD": "ssm:///missing"})
+	l.secrets = r
+
+	err := l.load(&struct{ Password string }{}, "MY_APP", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MY_APP_PASSWORD: resolving secret")
+}
+
+func TestSecretResolverRefresh(t *testing.T) {
+	r, ssmClient, _ := newTestSecretResolver()
+	l := testConfigLayers(nil, map[string]string{"MY_APP_PASSWORD": "ssm:///db/password"})
+	l.secrets = r
+
+	c := &struct{ Password Secret }{}
+	require.NoError(t, l.load(c, "MY_APP", nil))
+	require.Equal(t, "hunter2", c.Password.Value())
+
+	ssmClient.params["/db/password"] = "rotated"
+	r.refresh(context.TODO(), zerolog.Nop())
+
+	assert.Equal(t, "rotated", c.Password.Value())
+}
+
+func TestSecretString(t *testing.T) {
+	s := NewSecret("hunter2")
+
+	assert.Equal(t, "hunter2", s.Value())
+	assert.Equal(t, "[REDACTED]", s.String())
+	assert.Equal(t, "", Secret{}.Value())
+}
+
+func TestSecretResolverRefreshRereadConfig(t *testing.T) {
+	r, ssmClient, _ := newTestSecretResolver()
+	l := testConfigLayers(nil, map[string]string{"MY_APP_PASSWORD": "ssm:///db/password"})
+	l.secrets = r
+
+	first := &struct{ Password Secret }{}
+	require.NoError(t, l.load(first, "MY_APP", nil))
+	second := &struct{ Password Secret }{}
+	require.NoError(t, l.read(second, "MY_APP", nil))
+	require.Len(t, r.secrets, 1)
+
+	ssmClient.params["/db/password"] = "rotated"
+	ssmClient.calls = 0
+	r.refresh(context.TODO(), zerolog.Nop())
+
+	assert.Equal(t, 1, ssmClient.calls)
+	assert.Equal(t, "rotated", first.Password.Value())
+	assert.Equal(t, "rotated", second.Password.Value())
+}
+
+func TestSecretDecodeDoesNotChangeCopies(t *testing.T) {
+	s := NewSecret("hunter2")
+	c := s
+
+	require.NoError(t, c.Decode("ssm:///db/password"))
+
+	assert.Equal(t, "hunter2", s.Value())
+	assert.Equal(t, "ssm:///db/password", c.Value())
+}
+
+func TestValidateKeepsResolvedSecret(t *testing.T) {
+	r, ssmClient, _ := newTestSecretResolver()
+	l := testConfigLayers(nil, map[string]string{"MY_APP_PASSWORD": "ssm:///db/password"})
+	l.secrets = r
+
+	c := &struct{ Password Secret }{}
+	require.NoError(t, l.load(c, "MY_APP", nil))
+	require.Equal(t, "hunter2", c.Password.Value())
+
+	r.ttl = 0
+	delete(ssmClient.params, "/db/password")
+	require.Error(t, l.validate())
+
+	assert.Equal(t, "hunter2", c.Password.Value())
+}
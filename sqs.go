@@ -2,39 +2,111 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DropMsgErr may be returned by a handler, or wrapped in the error it returns,
+// to have a message that can never be processed deleted instead of retried.
+var DropMsgErr = errors.New("dropping message")
+
+// Outcomes of processing a message, recorded in the outcome label of the SQS
+// processing metrics. A failed message is retried until it has been received
+// MaxReceiveCount times, after which SQS moves it to the dead-letter queue.
+// When MaxReceiveCount is not configured a failure is recorded as an error.
+const (
+	outcomeSuccess      = "success"
+	outcomeError        = "error"
+	outcomeRetry        = "retry"
+	outcomeDropped      = "dropped"
+	outcomeDeadLettered = "dead-lettered"
+)
+
+// lagBuckets are the buckets of the message age and lag histograms, from
+// 100ms to around an hour, as messages may wait on the queue far longer than
+// they take to process.
+var lagBuckets = prometheus.ExponentialBuckets(0.1, 2, 16)
+
 type sqsWorkerState struct {
-	endpoint     string
-	receiveQueue string
-	msgTypeKey   string
-	handler      MsgHandler
-	queue        *Queue
-	wg           *sync.WaitGroup
-	logger       zerolog.Logger
-	metrics      *sqsMetrics
+	endpoint        string
+	receiveQueue    string
+	msgTypeKey      string
+	maxReceiveCount int
+	handler         MsgHandler
+	queue           *Queue
+	wg              *sync.WaitGroup
+	logger          zerolog.Logger
+	metrics         *sqsMetrics
 }
 
 type sqsMetrics struct {
-	msgReceived          *prometheus.CounterVec
-	msgProcessed         *prometheus.CounterVec
-	msgProcessedDuration *prometheus.HistogramVec
-	msgProcessedFailure  *prometheus.CounterVec
-	msgDeleted           *prometheus.CounterVec
+	msgReceived          Counter
+	msgAge               Histogram
+	msgAttempts          Counter
+	msgProcessedDuration Histogram
+	msgLag               Histogram
+	msgDeleted           Counter
+	msgRouted            Counter
+	msgUnrouted          Counter
+	msgUnknownType       Counter
+
+	// Counters of earlier versions, kept under PrometheusConfig.LegacyNames
+	// while dashboards are migrated, and nil otherwise.
+	legacyMsgProcessed        Counter
+	legacyMsgProcessedFailure Counter
 }
 
+// newSQSMetrics returns the metrics of SQS workers, shared by all the workers
+// of the app and labelled by queue. When legacy is true, the successes and
+// failures of processing messages are also counted as in earlier versions.
+func newSQSMetrics(m Meter, legacy bool) *sqsMetrics {
+	metrics := &sqsMetrics{
+		msgReceived:          m.Counter("sqs_msg_received_total", "The total number of SQS messages received", "queue"),
+		msgAge:               m.Histogram("sqs_msg_age_seconds", "The time messages spent on the queue before being received", lagBuckets, "queue"),
+		msgAttempts:          m.Counter("sqs_msg_attempts_total", "The total number of attempts to process SQS messages", "queue", "msg_type", "outcome"),
+		msgProcessedDuration: m.Histogram("sqs_msg_processed_duration_seconds", "The duration taken to process the message", nil, "queue", "msg_type", "outcome"),
+		msgLag:               m.Histogram("sqs_msg_lag_seconds", "The time from a message being sent to it being successfully processed", lagBuckets, "queue", "msg_type"),
+		msgDeleted:           m.Counter("sqs_msg_deleted_total", "The total number of SQS messages deleted", "queue"),
+		msgRouted:            m.Counter("sqs_msg_routed_total", "The total number of SQS messages routed to a handler", "queue", "msg_type"),
+		msgUnrouted:          m.Counter("sqs_msg_unrouted_total", "The total number of SQS messages that could not be routed as they have no msgType", "queue"),
+		msgUnknownType:       m.Counter("sqs_msg_unknown_type_total", "The total number of SQS messages with a msgType that has no handler", "queue"),
+	}
+
+	if legacy {
+		metrics.legacyMsgProcessed = m.Counter("sqs_msg_processed_total", "The total number of SQS messages processed", "queue")
+		metrics.legacyMsgProcessedFailure = m.Counter("sqs_msg_processed_failure_total", "The total number of SQS messages that failed to be processed", "queue")
+	}
+
+	return metrics
+}
+
+// SQSWorkerConfig holds configuration for an SQS worker. Name identifies the
+// worker as a logging component, allowing its log level to be set through
+// LogLevel or changed at runtime independently of the app's log level, and
+// LogSampling to apply stricter sampling than the app's to its logs.
+// MaxReceiveCount should match the maxReceiveCount of the queue's redrive
+// policy, so that failures of a message's last attempt are recorded as
+// dead-lettered rather than retried.
 type SQSWorkerConfig struct {
-	Endpoint     string
-	ReceiveQueue string
-	MsgTypeKey   string
+	Name            string `ignored:"true"`
+	Endpoint        string `desc:"SQS endpoint, overriding the default for the region"`
+	ReceiveQueue    string `required:"true" desc:"URL of the queue to receive messages from"`
+	MsgTypeKey      string `desc:"Message attribute holding the message type"`
+	MaxReceiveCount int    `desc:"maxReceiveCount of the queue's redrive policy"`
+	LogLevel        string `desc:"Log level of the worker, overriding the app's"`
+	LogSampling     LogSamplingConfig
 }
 
 func NewSQSWorkerConfig() *SQSWorkerConfig {
@@ -43,10 +115,18 @@ func NewSQSWorkerConfig() *SQSWorkerConfig {
 	}
 }
 
+// MsgContext holds a received message along with its context. Ctx carries
+// any trace and the correlation ID propagated with the message, and should be
+// used by handlers when sending follow-up messages so that they are carried on.
 type MsgContext struct {
-	Msg     *sqs.Message
-	MsgType *string
-	Logger  zerolog.Logger
+	Ctx           context.Context
+	Msg           *sqs.Message
+	MsgType       *string
+	CorrelationID string
+	Logger        zerolog.Logger
+
+	queue   string
+	metrics *sqsMetrics
 }
 
 type MsgHandler interface {
@@ -59,70 +139,96 @@ func (f MsgHandlerFunc) Process(msg *MsgContext) error {
 	return f(msg)
 }
 
+// AddSQS adds an SQS worker reading its configuration with prefix. The log
+// level of the worker is applied live when the configuration is reloaded.
 func (a *App) AddSQS(prefix string, handler MsgHandler) {
 	c := NewSQSWorkerConfig()
-	if err := a.ReadConfig(c, prefix); err != nil {
+	c.Name = prefix
+	config, err := ReadReloadableConfig(a, c, prefix)
+	if err != nil {
 		a.logger.Fatal().Err(err).Str("prefix", prefix).Msg("Cannot read configuration")
 	}
 
-	a.AddSQSWithConfig(c, handler)
+	a.AddSQSWithConfig(config.Load(), handler)
+	config.Subscribe(a.reloadSQSWorker)
+}
+
+// reloadSQSWorker applies a change to the configuration of an SQS worker.
+// Only the log level can change while the worker is running, so a warning is
+// logged that other changes need a restart.
+func (a *App) reloadSQSWorker(old, new *SQSWorkerConfig) {
+	if new.LogLevel != old.LogLevel {
+		if err := a.setComponentLogLevel(new.Name, new.LogLevel); err != nil {
+			a.logger.Error().Err(err).Str("component", new.Name).Msg("Invalid component log level")
+		}
+	}
+
+	unchanged := *new
+	unchanged.LogLevel = old.LogLevel
+	if !reflect.DeepEqual(&unchanged, old) {
+		a.logger.Warn().Str("component", new.Name).Msg("SQS worker configuration changed, restart to apply")
+	}
 }
 
 func (a *App) AddSQSWithConfig(config *SQSWorkerConfig, handler MsgHandler) {
-	s := &sqsWorkerState{
-		wg:           a.wg,
-		endpoint:     config.Endpoint,
-		receiveQueue: config.ReceiveQueue,
-		msgTypeKey:   config.MsgTypeKey,
-		handler:      handler,
-		logger:       a.logger.With().Str("queue", config.ReceiveQueue).Logger(),
+	name := config.Name
+	if name == "" {
+		name = config.ReceiveQueue
 	}
 
-	s.metrics = &sqsMetrics{
-		msgReceived:          a.Metrics.NewCounterVec("sqs_msg_received_total", "The total number of SQS messages received", []string{"app", "queue"}),
-		msgProcessed:         a.Metrics.NewCounterVec("sqs_msg_processed_total", "The total number of SQS messages processed", []string{"app", "queue"}),
-		msgProcessedFailure:  a.Metrics.NewCounterVec("sqs_msg_processed_failure_total", "The total number of SQS messages that failed to be processed", []string{"app", "queue"}),
-		msgProcessedDuration: a.Metrics.NewHistogramVec("sqs_msg_processed_duration_seconds", "The duration taken to process the message", []string{"app", "queue"}),
-		msgDeleted:           a.Metrics.NewCounterVec("sqs_msg_deleted_total", "The total number of SQS messages deleted", []string{"app", "queue"}),
+	s := &sqsWorkerState{
+		wg:              a.wg,
+		endpoint:        config.Endpoint,
+		receiveQueue:    config.ReceiveQueue,
+		msgTypeKey:      config.MsgTypeKey,
+		maxReceiveCount: config.MaxReceiveCount,
+		handler:         handler,
+		logger:          a.componentLogger(name, config.LogLevel, config.LogSampling).With().Str("queue", config.ReceiveQueue).Logger(),
 	}
 
+	s.metrics = newSQSMetrics(a.Meter, a.config.Prometheus.LegacyNames)
+
 	a.sqsWorkers = append(a.sqsWorkers, s)
 }
 
 func (a *App) startSQSWorkers(ctx context.Context) {
 	for _, ws := range a.sqsWorkers {
-		setupQueue(ws)
+		setupQueue(a.awsSession(), ws)
 		ws.logger.Debug().Msg("Starting queue worker")
-		go workerLoop(ctx, a.config.Name, ws)
+		go workerLoop(ctx, ws)
 		a.wg.Add(1)
 	}
 }
 
-func setupQueue(state *sqsWorkerState) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	sess.Config.MergeIn(aws.NewConfig().WithEndpoint(state.endpoint))
+func setupQueue(sess *session.Session, state *sqsWorkerState) {
+	sess = sess.Copy(aws.NewConfig().WithEndpoint(state.endpoint))
 
 	svc := sqs.New(sess)
 	queueConf := NewQueueConfig(state.msgTypeKey)
 	state.queue = NewQueue(queueConf, svc)
 }
 
-func newMessageContext(msg *sqs.Message, msgTypeKey string, logger zerolog.Logger) *MsgContext {
+func newMessageContext(ctx context.Context, msg *sqs.Message, msgTypeKey string, logger zerolog.Logger) *MsgContext {
 	var msgType *string
 	if msgTypeAttrib, ok := msg.MessageAttributes[msgTypeKey]; ok {
 		msgType = msgTypeAttrib.StringValue
 	}
 
+	ctx = otel.GetTextMapPropagator().Extract(ctx, sqsAttributeCarrier(msg.MessageAttributes))
+
+	correlationID := correlationIDAttribute(msg)
+	ctx = WithCorrelationID(ctx, correlationID)
+
 	return &MsgContext{
-		Msg:     msg,
-		MsgType: msgType,
-		Logger:  logger,
+		Ctx:           ctx,
+		Msg:           msg,
+		MsgType:       msgType,
+		CorrelationID: correlationID,
+		Logger:        logger.With().Str("correlationId", correlationID).Logger(),
 	}
 }
 
-func workerLoop(ctx context.Context, appName string, state *sqsWorkerState) {
+func workerLoop(ctx context.Context, state *sqsWorkerState) {
 	defer state.wg.Done()
 
 	for {
@@ -140,14 +246,26 @@ func workerLoop(ctx context.Context, appName string, state *sqsWorkerState) {
 
 			state.logger.Debug().Int("numMessages", len(messages)).Msg("Received messages")
 
-			state.metrics.msgReceived.With(prometheus.Labels{"app": appName, "queue": state.receiveQueue}).Add(float64(len(messages)))
+			state.metrics.msgReceived.Add(float64(len(messages)), state.receiveQueue)
 
 			for _, msg := range messages {
 				logger := state.logger.With().Str("messageId", *msg.MessageId).Logger()
 
-				msgCtx := newMessageContext(msg, state.msgTypeKey, logger)
+				if sent, ok := msgSentTime(msg); ok {
+					state.metrics.msgAge.Observe(time.Since(sent).Seconds(), state.receiveQueue)
+				}
 
-				if err := processMessage(ctx, msgCtx, state, appName); err != nil {
+				msgCtx := newMessageContext(ctx, msg, state.msgTypeKey, logger)
+				msgCtx.queue = state.receiveQueue
+				msgCtx.metrics = state.metrics
+				span := startConsumerSpan(msgCtx, state.receiveQueue)
+				logger = msgCtx.Logger
+
+				err := processMessage(ctx, msgCtx, state)
+				endSpan(span, err)
+				if errors.Is(err, DropMsgErr) {
+					logger.Warn().Err(err).Msg("Dropping message")
+				} else if err != nil {
 					logger.Error().Err(err).Msg("Failed to handle message")
 					continue
 				}
@@ -157,22 +275,118 @@ func workerLoop(ctx context.Context, appName string, state *sqsWorkerState) {
 					continue
 				}
 
-				state.metrics.msgDeleted.With(prometheus.Labels{"app": appName, "queue": state.receiveQueue}).Inc()
+				state.metrics.msgDeleted.Inc(state.receiveQueue)
 			}
 		}
 	}
 }
 
-func processMessage(ctx context.Context, msg *MsgContext, state *sqsWorkerState, appName string) error {
-	timer := prometheus.NewTimer(state.metrics.msgProcessedDuration.With(prometheus.Labels{"app": appName, "queue": state.receiveQueue}))
+// processMessage passes msg to the worker's handler, recording the duration
+// and outcome of every attempt, whether or not it succeeds.
+func processMessage(ctx context.Context, msg *MsgContext, state *sqsWorkerState) error {
+	start := time.Now()
+
+	err := state.handler.Process(msg)
 
-	if err := state.handler.Process(msg); err != nil {
-		state.metrics.msgProcessedFailure.With(prometheus.Labels{"app": appName, "queue": state.receiveQueue}).Inc()
+	msgType := msgTypeLabel(msg, state.handler)
+	outcome := msgOutcome(msg.Msg, err, state.maxReceiveCount)
+
+	observeWithExemplar(state.metrics.msgProcessedDuration, time.Since(start).Seconds(), msgExemplar(msg), state.receiveQueue, msgType, outcome)
+	state.metrics.msgAttempts.Inc(state.receiveQueue, msgType, outcome)
+	state.metrics.countLegacyProcessed(state.receiveQueue, err)
+
+	if err != nil {
 		return fmt.Errorf("processing message with handler: %w", err)
 	}
 
-	timer.ObserveDuration()
-	state.metrics.msgProcessed.With(prometheus.Labels{"app": appName, "queue": state.receiveQueue}).Inc()
+	if sent, ok := msgSentTime(msg.Msg); ok {
+		state.metrics.msgLag.Observe(time.Since(sent).Seconds(), state.receiveQueue, msgType)
+	}
+
+	return nil
+}
+
+// countLegacyProcessed counts a message as processed or failed in the
+// counters of earlier versions, if they are kept.
+func (m *sqsMetrics) countLegacyProcessed(queue string, err error) {
+	if m.legacyMsgProcessed == nil {
+		return
+	}
+
+	if err != nil {
+		m.legacyMsgProcessedFailure.Inc(queue)
+		return
+	}
+
+	m.legacyMsgProcessed.Inc(queue)
+}
+
+// msgOutcome returns the outcome of processing msg given the error returned
+// by its handler.
+func msgOutcome(msg *sqs.Message, err error, maxReceiveCount int) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, DropMsgErr):
+		return outcomeDropped
+	case maxReceiveCount <= 0:
+		return outcomeError
+	}
+
+	if count, ok := msgReceiveCount(msg); ok && count >= maxReceiveCount {
+		return outcomeDeadLettered
+	}
+
+	return outcomeRetry
+}
+
+// msgTypeLabel returns the msg_type label of msg. Types without a route on a
+// MsgRouter handler are labelled unknown, so that message attributes cannot
+// add series to the metrics without limit.
+func msgTypeLabel(msg *MsgContext, handler MsgHandler) string {
+	if msg.MsgType == nil {
+		return "none"
+	}
+
+	if r, ok := handler.(interface{ hasRoute(string) bool }); ok && !r.hasRoute(*msg.MsgType) {
+		return "unknown"
+	}
+
+	return *msg.MsgType
+}
+
+// msgSentTime returns the time msg was sent, from its SentTimestamp attribute.
+func msgSentTime(msg *sqs.Message) (time.Time, bool) {
+	ms, err := strconv.ParseInt(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// msgReceiveCount returns the number of times msg has been received, from
+// its ApproximateReceiveCount attribute.
+func msgReceiveCount(msg *sqs.Message) (int, bool) {
+	count, err := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if err != nil {
+		return 0, false
+	}
+
+	return count, true
+}
+
+// msgExemplar returns the exemplar labels linking a metric observation to
+// msg, using the trace ID when the message is sampled for tracing and
+// otherwise its message ID.
+func msgExemplar(msg *MsgContext) map[string]string {
+	if sc := trace.SpanContextFromContext(msg.Ctx); sc.IsSampled() {
+		return map[string]string{"trace_id": sc.TraceID().String()}
+	}
+
+	if id := aws.StringValue(msg.Msg.MessageId); id != "" {
+		return map[string]string{"message_id": id}
+	}
 
 	return nil
 }
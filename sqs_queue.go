@@ -9,6 +9,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Receiver is an interface for receiving messages from a queue.
@@ -74,10 +77,24 @@ func (q Queue) Delete(ctx context.Context, msg *sqs.Message, queue string) error
 	return nil
 }
 
-func (q Queue) Send(ctx context.Context, body string, queue string) error {
+// Send sends a message with body to queue. The trace and correlation ID in
+// ctx are propagated to the receiver of the message through its message attributes.
+func (q Queue) Send(ctx context.Context, body string, queue string) (err error) {
+	ctx, span := tracer().Start(ctx, "send "+queue,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.operation", "publish"),
+			attribute.String("messaging.destination.name", queue),
+		),
+	)
+	defer func() { endSpan(span, err) }()
+
 	input := newSendMessageInput(queue, body)
+	otel.GetTextMapPropagator().Inject(ctx, sqsAttributeCarrier(input.MessageAttributes))
+	setCorrelationIDAttribute(ctx, input.MessageAttributes)
 
-	_, err := q.svc.SendMessageWithContext(ctx, input)
+	_, err = q.svc.SendMessageWithContext(ctx, input)
 	if err != nil {
 		if isAwsCancelledError(err) {
 			return nil
@@ -100,7 +117,11 @@ func newReceiveMessageInput(queue string, maxNumMessages int, waitTimeSeconds in
 		QueueUrl:              aws.String(queue),
 		MaxNumberOfMessages:   aws.Int64(int64(maxNumMessages)),
 		WaitTimeSeconds:       aws.Int64(int64(waitTimeSeconds)),
-		MessageAttributeNames: aws.StringSlice([]string{msgTypeKey}),
+		MessageAttributeNames: aws.StringSlice(append([]string{msgTypeKey, CorrelationIDAttribute}, otel.GetTextMapPropagator().Fields()...)),
+		AttributeNames: aws.StringSlice([]string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount,
+			sqs.MessageSystemAttributeNameSentTimestamp,
+		}),
 	}
 
 	return input
@@ -115,7 +136,8 @@ func newDeleteMessageInput(queue string, msg *sqs.Message) *sqs.DeleteMessageInp
 
 func newSendMessageInput(queue string, body string) *sqs.SendMessageInput {
 	return &sqs.SendMessageInput{
-		QueueUrl:    aws.String(queue),
-		MessageBody: aws.String(body),
+		QueueUrl:          aws.String(queue),
+		MessageBody:       aws.String(body),
+		MessageAttributes: make(map[string]*sqs.MessageAttributeValue),
 	}
 }
@@ -21,6 +21,9 @@ func TestNewReceiveMessageInput(t *testing.T) {
 	assert.Equal(t, aws.Int64(10), rmi.WaitTimeSeconds)
 	assert.Equal(t, aws.Int64(1), rmi.MaxNumberOfMessages)
 	assert.Contains(t, rmi.MessageAttributeNames, aws.String("msgType"))
+	assert.Contains(t, rmi.MessageAttributeNames, aws.String(CorrelationIDAttribute))
+	assert.Contains(t, rmi.AttributeNames, aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount))
+	assert.Contains(t, rmi.AttributeNames, aws.String(sqs.MessageSystemAttributeNameSentTimestamp))
 }
 
 func TestNewDeleteMessageInput(t *testing.T) {
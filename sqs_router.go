@@ -2,18 +2,10 @@ package app
 
 import (
 	"errors"
-
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
 	NoMsgTypeErr = errors.New("no msgType attribute found on message")
-
-	msgRouted = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "sf_go_app_sqs_msg_routed_total",
-		Help: "The total number of SQS messages routed to a handler",
-	}, []string{"msg_type"})
 )
 
 // MsgRouter handles routing messages to handlers based
@@ -36,12 +28,22 @@ func (r *MsgRouter) HandleFunc(msgType string, handler MsgHandlerFunc) {
 	r.routes[msgType] = handler
 }
 
+// hasRoute reports whether a handler is registered for msgType.
+func (r MsgRouter) hasRoute(msgType string) bool {
+	_, ok := r.routes[msgType]
+	return ok
+}
+
 // Process will pass msg to the registered handler for the
-// message's message type.
+// message's message type. Messages received by an SQS worker are counted
+// in the app's metrics as routed, unrouted or of an unknown msgType.
 func (r MsgRouter) Process(msg *MsgContext) error {
 	msg.Logger.Debug().Msg("Routing message")
 
 	if msg.MsgType == nil {
+		if msg.metrics != nil {
+			msg.metrics.msgUnrouted.Inc(msg.queue)
+		}
 		return NoMsgTypeErr
 	}
 
@@ -50,12 +52,18 @@ func (r MsgRouter) Process(msg *MsgContext) error {
 
 	h, ok := r.routes[*msg.MsgType]
 	if !ok {
+		msg.Logger.Debug().Msg("No handler for msgType")
+		if msg.metrics != nil {
+			msg.metrics.msgUnknownType.Inc(msg.queue)
+		}
 		return nil
 	}
 
 	msg.Logger.Debug().Msg("Processing message")
 
-	msgRouted.With(prometheus.Labels{"msg_type": *msg.MsgType}).Inc()
+	if msg.metrics != nil {
+		msg.metrics.msgRouted.Inc(msg.queue, *msg.MsgType)
+	}
 
 	return h.Process(msg)
 }
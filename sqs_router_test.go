@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -31,14 +32,17 @@ func TestMsgRouterProcess(t *testing.T) {
 	otherMsgType := "bar"
 
 	testCases := []struct {
-		name       string
-		msgType    *string
-		outHandled bool
-		outErr     error
+		name        string
+		msgType     *string
+		outHandled  bool
+		outErr      error
+		outRouted   float64
+		outUnrouted float64
+		outUnknown  float64
 	}{
-		{name: "no msgType", msgType: nil, outHandled: false, outErr: NoMsgTypeErr},
-		{name: "matching msgType", msgType: &msgType, outHandled: true, outErr: nil},
-		{name: "non-matching msgType", msgType: &otherMsgType, outHandled: false, outErr: nil},
+		{name: "no msgType", msgType: nil, outHandled: false, outErr: NoMsgTypeErr, outUnrouted: 1},
+		{name: "matching msgType", msgType: &msgType, outHandled: true, outErr: nil, outRouted: 1},
+		{name: "non-matching msgType", msgType: &otherMsgType, outHandled: false, outErr: nil, outUnknown: 1},
 	}
 
 	for _, tc := range testCases {
@@ -56,7 +60,11 @@ func TestMsgRouterProcess(t *testing.T) {
 				msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{"msgType": &sqs.MessageAttributeValue{StringValue: tc.msgType}})
 			}
 
-			msgCtx := newMessageContext(msg, "msgType", zerolog.New(nil))
+			meter := newRecordingMeter()
+
+			msgCtx := newMessageContext(context.TODO(), msg, "msgType", zerolog.New(nil))
+			msgCtx.queue = "test-queue"
+			msgCtx.metrics = newSQSMetrics(meter, false)
 
 			err := mr.Process(msgCtx)
 
@@ -67,6 +75,9 @@ func TestMsgRouterProcess(t *testing.T) {
 			}
 
 			assert.Equal(t, tc.outHandled, handled, "message handled")
+			assert.Equal(t, tc.outRouted, meter.value("sqs_msg_routed_total", "test-queue", msgType), "routed")
+			assert.Equal(t, tc.outUnrouted, meter.value("sqs_msg_unrouted_total", "test-queue"), "unrouted")
+			assert.Equal(t, tc.outUnknown, meter.value("sqs_msg_unknown_type_total", "test-queue"), "unknown msgType")
 		})
 	}
 }
@@ -1,14 +1,20 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestAddSQS(t *testing.T) {
@@ -43,6 +49,18 @@ func TestAddSQSWithConfig(t *testing.T) {
 	assert.NotNil(t, app.sqsWorkers[0].handler)
 }
 
+func TestAddSQSTwice(t *testing.T) {
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	assert.NotPanics(t, func() {
+		app.AddSQSWithConfig(&SQSWorkerConfig{ReceiveQueue: "foo-queue"}, NewMsgRouter())
+		app.AddSQSWithConfig(&SQSWorkerConfig{ReceiveQueue: "bar-queue"}, NewMsgRouter())
+	})
+
+	assert.Len(t, app.sqsWorkers, 2)
+	assert.Equal(t, app.sqsWorkers[0].metrics.msgReceived, app.sqsWorkers[1].metrics.msgReceived)
+}
+
 func TestNewSQSWorkerConfig(t *testing.T) {
 	c := NewSQSWorkerConfig()
 
@@ -53,9 +71,191 @@ func TestNewMessageContext(t *testing.T) {
 	msg := &sqs.Message{}
 	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{"msgType": &sqs.MessageAttributeValue{StringValue: aws.String("foo")}})
 
-	msgCtx := newMessageContext(msg, "msgType", zerolog.New(os.Stderr))
+	msgCtx := newMessageContext(context.TODO(), msg, "msgType", zerolog.New(os.Stderr))
 
 	require.NotNil(t, msgCtx, "message context nil")
 	assert.NotNil(t, msgCtx.Msg, "message not set")
 	assert.Equal(t, "foo", *msgCtx.MsgType, "wrong msgType")
 }
+
+func TestMsgExemplar(t *testing.T) {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		flags     trace.TraceFlags
+		messageID *string
+		out       map[string]string
+	}{
+		{name: "sampled trace", flags: trace.FlagsSampled, messageID: aws.String("msg-1"), out: map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}},
+		{name: "unsampled trace", flags: 0, messageID: aws.String("msg-1"), out: map[string]string{"message_id": "msg-1"}},
+		{name: "no message ID", flags: 0, messageID: nil, out: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := trace.ContextWithSpanContext(context.TODO(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: tc.flags}))
+			msgCtx := &MsgContext{Ctx: ctx, Msg: &sqs.Message{MessageId: tc.messageID}}
+
+			assert.Equal(t, tc.out, msgExemplar(msgCtx))
+		})
+	}
+}
+
+func TestMsgOutcome(t *testing.T) {
+	testCases := []struct {
+		name            string
+		receiveCount    string
+		maxReceiveCount int
+		err             error
+		out             string
+	}{
+		{name: "success", receiveCount: "1", maxReceiveCount: 3, err: nil, out: outcomeSuccess},
+		{name: "dropped", receiveCount: "1", maxReceiveCount: 3, err: DropMsgErr, out: outcomeDropped},
+		{name: "wrapped dropped", receiveCount: "3", maxReceiveCount: 3, err: fmt.Errorf("bad payload: %w", DropMsgErr), out: outcomeDropped},
+		{name: "error without max receive count", receiveCount: "3", maxReceiveCount: 0, err: errors.New("failed"), out: outcomeError},
+		{name: "retry", receiveCount: "2", maxReceiveCount: 3, err: errors.New("failed"), out: outcomeRetry},
+		{name: "dead-lettered", receiveCount: "3", maxReceiveCount: 3, err: errors.New("failed"), out: outcomeDeadLettered},
+		{name: "missing receive count", receiveCount: "", maxReceiveCount: 3, err: errors.New("failed"), out: outcomeRetry},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &sqs.Message{Attributes: map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(tc.receiveCount)}}
+
+			assert.Equal(t, tc.out, msgOutcome(msg, tc.err, tc.maxReceiveCount))
+		})
+	}
+}
+
+func TestMsgSentTime(t *testing.T) {
+	msg := &sqs.Message{Attributes: map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1700000000123")}}
+
+	sent, ok := msgSentTime(msg)
+	require.True(t, ok)
+	assert.Equal(t, time.Unix(1700000000, 123*int64(time.Millisecond)), sent)
+
+	_, ok = msgSentTime(&sqs.Message{})
+	assert.False(t, ok)
+}
+
+func TestProcessMessageMetrics(t *testing.T) {
+	testCases := []struct {
+		name       string
+		handlerErr error
+		outErr     bool
+		outcome    string
+		outLag     bool
+	}{
+		{name: "success", handlerErr: nil, outcome: outcomeSuccess, outLag: true},
+		{name: "failure", handlerErr: errors.New("failed"), outErr: true, outcome: outcomeRetry},
+		{name: "dropped", handlerErr: DropMsgErr, outErr: true, outcome: outcomeDropped},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meter := newRecordingMeter()
+			state := &sqsWorkerState{
+				receiveQueue:    "test-queue",
+				maxReceiveCount: 3,
+				metrics:         newSQSMetrics(meter, false),
+				handler: MsgHandlerFunc(func(msg *MsgContext) error {
+					time.Sleep(time.Millisecond)
+					return tc.handlerErr
+				}),
+			}
+
+			msg := &sqs.Message{Attributes: map[string]*string{
+				sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("1"),
+				sqs.MessageSystemAttributeNameSentTimestamp:           aws.String(strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano()/int64(time.Millisecond), 10)),
+			}}
+			msgCtx := &MsgContext{Ctx: context.TODO(), Msg: msg, MsgType: aws.String("foo")}
+
+			err := processMessage(context.TODO(), msgCtx, state)
+
+			assert.Equal(t, tc.outErr, err != nil)
+			if tc.handlerErr != nil {
+				assert.True(t, errors.Is(err, tc.handlerErr))
+			}
+			assert.Equal(t, 1.0, meter.value("sqs_msg_attempts_total", "test-queue", "foo", tc.outcome))
+			assert.Greater(t, meter.value("sqs_msg_processed_duration_seconds", "test-queue", "foo", tc.outcome), 0.0)
+			assert.Equal(t, tc.outLag, meter.value("sqs_msg_lag_seconds", "test-queue", "foo") >= 60)
+		})
+	}
+}
+
+func TestProcessMessageLegacyMetrics(t *testing.T) {
+	testCases := []struct {
+		name         string
+		legacy       bool
+		handlerErr   error
+		outProcessed float64
+		outFailure   float64
+	}{
+		{name: "success", legacy: true, outProcessed: 1},
+		{name: "failure", legacy: true, handlerErr: errors.New("failed"), outFailure: 1},
+		{name: "dropped", legacy: true, handlerErr: DropMsgErr, outFailure: 1},
+		{name: "not legacy", legacy: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meter := newRecordingMeter()
+			state := &sqsWorkerState{
+				receiveQueue: "test-queue",
+				metrics:      newSQSMetrics(meter, tc.legacy),
+				handler:      MsgHandlerFunc(func(msg *MsgContext) error { return tc.handlerErr }),
+			}
+			msgCtx := &MsgContext{Ctx: context.TODO(), Msg: &sqs.Message{}, MsgType: aws.String("foo")}
+
+			processMessage(context.TODO(), msgCtx, state)
+
+			assert.Equal(t, tc.outProcessed, meter.value("sqs_msg_processed_total", "test-queue"))
+			assert.Equal(t, tc.outFailure, meter.value("sqs_msg_processed_failure_total", "test-queue"))
+			assert.Equal(t, 1.0, meter.value("sqs_msg_attempts_total", "test-queue", "foo", msgOutcome(msgCtx.Msg, tc.handlerErr, 0)))
+		})
+	}
+}
+
+func TestAddSQSComponentLogLevel(t *testing.T) {
+	os.Setenv("MY_APP_FOO_LOGLEVEL", "error")
+	defer os.Unsetenv("MY_APP_FOO_LOGLEVEL")
+	os.Setenv("MY_APP_FOO_RECEIVEQUEUE", "test-queue")
+	defer os.Unsetenv("MY_APP_FOO_RECEIVEQUEUE")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddSQS("Foo", NewMsgRouter())
+
+	l, err := app.logLevels.lookup("Foo")
+	require.NoError(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, l.Level())
+	assert.Equal(t, zerolog.DebugLevel, app.logLevels.app.Level())
+}
+
+func TestMsgTypeLabel(t *testing.T) {
+	router := NewMsgRouter()
+	router.HandleFunc("foo", func(msg *MsgContext) error { return nil })
+	handler := MsgHandlerFunc(func(msg *MsgContext) error { return nil })
+
+	testCases := []struct {
+		name    string
+		msgType *string
+		handler MsgHandler
+		out     string
+	}{
+		{name: "no msgType", msgType: nil, handler: router, out: "none"},
+		{name: "routed", msgType: aws.String("foo"), handler: router, out: "foo"},
+		{name: "not routed", msgType: aws.String("bar"), handler: router, out: "unknown"},
+		{name: "router value", msgType: aws.String("bar"), handler: *router, out: "unknown"},
+		{name: "other handler", msgType: aws.String("bar"), handler: handler, out: "bar"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, msgTypeLabel(&MsgContext{MsgType: tc.msgType}, tc.handler))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StatsDConfig holds configuration for shipping metrics to a DogStatsD agent
+// over UDP in place of Prometheus. Metric names are Prefix and the name
+// joined by a dot, and Tags are added to every metric along with the app's
+// env and version.
+type StatsDConfig struct {
+	Enabled bool              `desc:"Send metrics to a DogStatsD agent"`
+	Address string            `default:"127.0.0.1:8125" validate:"hostport" desc:"Address of the DogStatsD agent"`
+	Prefix  string            `desc:"Prefix of metric names"`
+	Tags    map[string]string `desc:"Tags added to every metric, e.g. region:eu"`
+}
+
+// statsdMeter is a Meter sending metrics in the DogStatsD datagram format,
+// with labels sent as tags. Sending is best effort, so metrics are lost if
+// the agent is not listening.
+type statsdMeter struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+func newStatsDMeter(config StatsDConfig, constTags map[string]string) (*statsdMeter, error) {
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to statsd agent at %q: %w", config.Address, err)
+	}
+
+	tags := make([]string, 0, len(constTags)+len(config.Tags))
+	for k, v := range constTags {
+		if _, ok := config.Tags[k]; !ok {
+			tags = append(tags, k+":"+v)
+		}
+	}
+	for k, v := range config.Tags {
+		tags = append(tags, k+":"+v)
+	}
+	sort.Strings(tags)
+
+	return &statsdMeter{conn: conn, prefix: config.Prefix, tags: tags}, nil
+}
+
+func (m *statsdMeter) Counter(name string, help string, labelNames ...string) Counter {
+	return statsdMetric{meter: m, name: m.name(name), labelNames: labelNames}
+}
+
+func (m *statsdMeter) Gauge(name string, help string, labelNames ...string) Gauge {
+	return statsdMetric{meter: m, name: m.name(name), labelNames: labelNames}
+}
+
+func (m *statsdMeter) Histogram(name string, help string, buckets []float64, labelNames ...string) Histogram {
+	return statsdMetric{meter: m, name: m.name(name), labelNames: labelNames}
+}
+
+// Close closes the connection to the agent.
+func (m *statsdMeter) Close() error {
+	return m.conn.Close()
+}
+
+func (m *statsdMeter) name(name string) string {
+	if m.prefix == "" {
+		return name
+	}
+
+	return m.prefix + "." + name
+}
+
+// send writes a single datagram of the form name:value|type|#tag:value,...
+func (m *statsdMeter) send(name string, value float64, metricType string, labelNames []string, labelValues []string) {
+	if len(labelNames) != len(labelValues) {
+		panic(fmt.Sprintf("%s: expected %d label values but got %d", name, len(labelNames), len(labelValues)))
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(metricType)
+
+	tags := append(make([]string, 0, len(m.tags)+len(labelNames)), m.tags...)
+	for i, n := range labelNames {
+		tags = append(tags, n+":"+labelValues[i])
+	}
+	if len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+
+	m.conn.Write([]byte(b.String()))
+}
+
+type statsdMetric struct {
+	meter      *statsdMeter
+	name       string
+	labelNames []string
+}
+
+func (s statsdMetric) Inc(labelValues ...string) {
+	s.meter.send(s.name, 1, "c", s.labelNames, labelValues)
+}
+
+func (s statsdMetric) Add(delta float64, labelValues ...string) {
+	s.meter.send(s.name, delta, "c", s.labelNames, labelValues)
+}
+
+func (s statsdMetric) Set(value float64, labelValues ...string) {
+	s.meter.send(s.name, value, "g", s.labelNames, labelValues)
+}
+
+func (s statsdMetric) Observe(value float64, labelValues ...string) {
+	s.meter.send(s.name, value, "h", s.labelNames, labelValues)
+}
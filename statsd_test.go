@@ -0,0 +1,131 @@
+package app
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenStatsD returns a local UDP listener standing in for a DogStatsD agent.
+func listenStatsD(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	return string(buf[:n])
+}
+
+func TestStatsDMeter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config StatsDConfig
+		record func(m Meter)
+		out    string
+	}{
+		{
+			name:   "counter inc",
+			config: StatsDConfig{},
+			record: func(m Meter) { m.Counter("msg_total", "", "queue").Inc("foo") },
+			out:    "msg_total:1|c|#queue:foo",
+		},
+		{
+			name:   "counter add",
+			config: StatsDConfig{Prefix: "myapp"},
+			record: func(m Meter) { m.Counter("msg_total", "", "queue").Add(2.5, "foo") },
+			out:    "myapp.msg_total:2.5|c|#queue:foo",
+		},
+		{
+			name:   "gauge",
+			config: StatsDConfig{},
+			record: func(m Meter) { m.Gauge("inflight", "").Set(3) },
+			out:    "inflight:3|g",
+		},
+		{
+			name:   "histogram",
+			config: StatsDConfig{},
+			record: func(m Meter) {
+				m.Histogram("duration_seconds", "", nil, "queue", "msg_type").Observe(0.25, "foo", "bar")
+			},
+			out: "duration_seconds:0.25|h|#queue:foo,msg_type:bar",
+		},
+		{
+			name:   "tags",
+			config: StatsDConfig{Tags: map[string]string{"region": "eu"}},
+			record: func(m Meter) { m.Counter("msg_total", "", "queue").Inc("foo") },
+			out:    "msg_total:1|c|#region:eu,queue:foo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			agent := listenStatsD(t)
+			tc.config.Address = agent.LocalAddr().String()
+
+			m, err := newStatsDMeter(tc.config, nil)
+			require.NoError(t, err)
+			defer m.Close()
+
+			tc.record(m)
+
+			assert.Equal(t, tc.out, readDatagram(t, agent))
+		})
+	}
+}
+
+func TestStatsDMeterConstTags(t *testing.T) {
+	agent := listenStatsD(t)
+
+	m, err := newStatsDMeter(StatsDConfig{Address: agent.LocalAddr().String(), Tags: map[string]string{"env": "override"}}, map[string]string{"env": "test", "version": "1.2.3"})
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Counter("msg_total", "").Inc()
+
+	assert.Equal(t, "msg_total:1|c|#env:override,version:1.2.3", readDatagram(t, agent))
+}
+
+func TestStatsDMeterLabelMismatch(t *testing.T) {
+	agent := listenStatsD(t)
+
+	m, err := newStatsDMeter(StatsDConfig{Address: agent.LocalAddr().String()}, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	assert.Panics(t, func() { m.Counter("msg_total", "", "queue").Inc() })
+}
+
+func TestNewAppWithStatsD(t *testing.T) {
+	agent := listenStatsD(t)
+
+	os.Setenv("MY_APP_STATSD_ENABLED", "true")
+	defer os.Unsetenv("MY_APP_STATSD_ENABLED")
+	os.Setenv("MY_APP_STATSD_ADDRESS", agent.LocalAddr().String())
+	defer os.Unsetenv("MY_APP_STATSD_ADDRESS")
+	os.Setenv("MY_APP_ENV", "test")
+	defer os.Unsetenv("MY_APP_ENV")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	require.IsType(t, &statsdMeter{}, app.Meter)
+
+	app.AddSQSWithConfig(&SQSWorkerConfig{ReceiveQueue: "test-queue"}, NewMsgRouter())
+	app.sqsWorkers[0].metrics.msgReceived.Add(2, "test-queue")
+
+	assert.Equal(t, "sqs_msg_received_total:2|c|#env:test,queue:test-queue", readDatagram(t, agent))
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/andoco/go-app"
+
+// TracingConfig holds configuration for OpenTelemetry tracing. Exporter is
+// either otlp, which sends spans over gRPC to the collector at Endpoint, or
+// stdout, which writes spans to stdout for local development. SampleRatio is
+// the fraction of new traces that are sampled.
+type TracingConfig struct {
+	Enabled     bool    `desc:"Export traces"`
+	Exporter    string  `default:"otlp" validate:"oneof=otlp stdout" desc:"Trace exporter: otlp or stdout"`
+	Endpoint    string  `default:"localhost:4317" validate:"hostport" desc:"Address of the OTLP collector"`
+	Insecure    bool    `default:"true" desc:"Connect to the OTLP collector without TLS"`
+	SampleRatio float64 `default:"1" validate:"min=0,max=1" desc:"Fraction of new traces sampled"`
+}
+
+// setupTracing creates a tracer provider exporting spans as configured, and
+// installs it along with the W3C trace context and baggage propagators as the
+// global OpenTelemetry providers.
+func (a *App) setupTracing(ctx context.Context) error {
+	exporter, err := newSpanExporter(ctx, a.config.Tracing)
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", a.config.Name),
+		attribute.String("deployment.environment", a.config.Env),
+	))
+	if err != nil {
+		return fmt.Errorf("creating tracing resource: %w", err)
+	}
+
+	a.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(a.config.Tracing.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(a.tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return nil
+}
+
+// shutdownTracing flushes any buffered spans to the exporter.
+func (a *App) shutdownTracing(ctx context.Context) {
+	if a.tracerProvider == nil {
+		return
+	}
+
+	if err := a.tracerProvider.Shutdown(ctx); err != nil {
+		a.logger.Error().Err(err).Msg("Failed to shutdown tracing")
+	}
+}
+
+func newSpanExporter(ctx context.Context, config TracingConfig) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceLogger returns logger with the trace and span IDs of the span in ctx,
+// if there is one.
+func TraceLogger(ctx context.Context, logger zerolog.Logger) zerolog.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return logger
+	}
+
+	return logger.With().Str("traceId", sc.TraceID().String()).Str("spanId", sc.SpanID().String()).Logger()
+}
+
+// traceHandler wraps h to start a server span for each request, continuing
+// any trace propagated in the request headers. A logger with the trace and
+// span IDs is added to the request context, available through zerolog.Ctx.
+func (a *App) traceHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		logger := TraceLogger(ctx, a.logger)
+		ctx = logger.WithContext(ctx)
+
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// statusResponseWriter records the status code written to the response while
+// still allowing handlers to flush and hijack the connection.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// startConsumerSpan starts a span for processing msg received from queue,
+// continuing any trace propagated in the message attributes of msg, and
+// updates the context and logger of msg for the span.
+func startConsumerSpan(msg *MsgContext, queue string) trace.Span {
+	ctx, span := tracer().Start(msg.Ctx, "process "+queue,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.destination.name", queue),
+			attribute.String("messaging.message.id", aws.StringValue(msg.Msg.MessageId)),
+		),
+	)
+
+	msg.Ctx = ctx
+	msg.Logger = TraceLogger(ctx, msg.Logger)
+
+	return span
+}
+
+// endSpan records err on span, if not nil, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sqsAttributeCarrier adapts SQS message attributes to a propagation.TextMapCarrier.
+type sqsAttributeCarrier map[string]*sqs.MessageAttributeValue
+
+func (c sqsAttributeCarrier) Get(key string) string {
+	if v, ok := c[key]; ok && v != nil {
+		return aws.StringValue(v.StringValue)
+	}
+	return ""
+}
+
+func (c sqsAttributeCarrier) Set(key string, value string) {
+	c[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+}
+
+func (c sqsAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
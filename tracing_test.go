@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func setupTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return recorder
+}
+
+func TestTraceHandler(t *testing.T) {
+	recorder := setupTestTracing(t)
+	buf := &bytes.Buffer{}
+	app := NewApp(NewAppConfig("MyApp").WithLogWriter(buf))
+
+	handler := app.traceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Info().Msg("handling")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("traceparent", testTraceParent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "Error", spans[0].Status().Code.String())
+	assert.Contains(t, buf.String(), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+}
+
+func TestSendInjectsTraceContext(t *testing.T) {
+	recorder := setupTestTracing(t)
+	mockSvc := &mockSQSClient{}
+	queue := NewQueue(NewQueueConfig("msgType"), mockSvc)
+
+	ctx, span := tracer().Start(context.Background(), "parent")
+	err := queue.Send(ctx, "test-body", "test-queue")
+	span.End()
+
+	require.NoError(t, err)
+	require.NotNil(t, mockSvc.sendInput)
+	require.Contains(t, mockSvc.sendInput.MessageAttributes, "traceparent")
+	assert.Contains(t, *mockSvc.sendInput.MessageAttributes["traceparent"].StringValue, span.SpanContext().TraceID().String())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind())
+}
+
+func TestNewMessageContextExtractsTraceContext(t *testing.T) {
+	setupTestTracing(t)
+
+	msg := &sqs.Message{MessageId: aws.String("test-id")}
+	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{"traceparent": {StringValue: aws.String(testTraceParent)}})
+
+	msgCtx := newMessageContext(context.Background(), msg, "msgType", zerolog.Nop())
+
+	sc := trace.SpanContextFromContext(msgCtx.Ctx)
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+}
+
+func TestStartConsumerSpan(t *testing.T) {
+	recorder := setupTestTracing(t)
+	buf := &bytes.Buffer{}
+
+	msg := &sqs.Message{MessageId: aws.String("test-id")}
+	msg.SetMessageAttributes(map[string]*sqs.MessageAttributeValue{"traceparent": {StringValue: aws.String(testTraceParent)}})
+	msgCtx := newMessageContext(context.Background(), msg, "msgType", zerolog.New(buf))
+
+	span := startConsumerSpan(msgCtx, "test-queue")
+	msgCtx.Logger.Info().Msg("processing")
+	endSpan(span, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindConsumer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].Parent().TraceID().String())
+	assert.Contains(t, buf.String(), spans[0].SpanContext().SpanID().String())
+}
+
+func TestTraceLoggerWithoutSpan(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := TraceLogger(context.Background(), zerolog.New(buf))
+	logger.Info().Msg("test")
+
+	assert.NotContains(t, buf.String(), "traceId")
+}
+
+func TestNewSpanExporter(t *testing.T) {
+	_, err := newSpanExporter(context.Background(), TracingConfig{Exporter: "stdout"})
+	assert.NoError(t, err)
+
+	_, err = newSpanExporter(context.Background(), TracingConfig{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
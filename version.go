@@ -0,0 +1,86 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// version and commit identify the build of the app, and are intended to be
+// set through the linker, e.g.
+//
+//	go build -ldflags "-X github.com/andoco/go-app.version=1.2.3 -X github.com/andoco/go-app.commit=$(git rev-parse HEAD)"
+//
+// When not set, they are taken from the module version and VCS revision
+// embedded in the binary by the Go toolchain.
+var (
+	version string
+	commit  string
+)
+
+// VersionInfo describes the running build of the app.
+type VersionInfo struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	Env       string    `json:"env"`
+	GoVersion string    `json:"goVersion"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// VersionInfo returns the version, commit and start time of the app.
+func (a *App) VersionInfo() VersionInfo {
+	return a.versionInfo
+}
+
+// resolveVersionInfo returns the version information of the build, with the
+// version configured through AppConfig.Version taking precedence.
+func resolveVersionInfo(config AppConfig, start time.Time) VersionInfo {
+	info := VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		Env:       config.Env,
+		GoVersion: runtime.Version(),
+		StartTime: start,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+
+		for _, s := range bi.Settings {
+			if info.Commit == "" && s.Key == "vcs.revision" {
+				info.Commit = s.Value
+			}
+		}
+	}
+
+	if config.Version != "" {
+		info.Version = config.Version
+	}
+
+	return info
+}
+
+// versionLogger returns logger with the version and commit of the app, if known.
+func versionLogger(logger zerolog.Logger, info VersionInfo) zerolog.Logger {
+	ctx := logger.With()
+	if info.Version != "" {
+		ctx = ctx.Str("version", info.Version)
+	}
+	if info.Commit != "" {
+		ctx = ctx.Str("commit", info.Commit)
+	}
+
+	return ctx.Logger()
+}
+
+// versionHandler writes the version information of the app as JSON.
+func (a *App) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.versionInfo)
+}
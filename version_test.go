@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveVersionInfo(t *testing.T) {
+	testCases := []struct {
+		name       string
+		ldVersion  string
+		ldCommit   string
+		config     AppConfig
+		outVersion string
+		outCommit  string
+	}{
+		{name: "ldflags", ldVersion: "1.0.0", ldCommit: "abc123", config: AppConfig{Env: "dev"}, outVersion: "1.0.0", outCommit: "abc123"},
+		{name: "config overrides ldflags", ldVersion: "1.0.0", ldCommit: "abc123", config: AppConfig{Env: "dev", Version: "2.0.0"}, outVersion: "2.0.0", outCommit: "abc123"},
+		{name: "config only", config: AppConfig{Env: "dev", Version: "2.0.0"}, outVersion: "2.0.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, commit = tc.ldVersion, tc.ldCommit
+			defer func() { version, commit = "", "" }()
+
+			start := time.Now()
+			info := resolveVersionInfo(tc.config, start)
+
+			assert.Equal(t, tc.outVersion, info.Version)
+			assert.Equal(t, tc.outCommit, info.Commit)
+			assert.Equal(t, "dev", info.Env)
+			assert.Equal(t, start, info.StartTime)
+			assert.NotEmpty(t, info.GoVersion)
+		})
+	}
+}
+
+func TestVersionLogger(t *testing.T) {
+	testCases := []struct {
+		name string
+		info VersionInfo
+		out  string
+	}{
+		{name: "version and commit", info: VersionInfo{Version: "1.0.0", Commit: "abc123"}, out: `{"level":"info","version":"1.0.0","commit":"abc123"}` + "\n"},
+		{name: "unknown", info: VersionInfo{}, out: `{"level":"info"}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := versionLogger(zerolog.New(buf), tc.info)
+
+			logger.Info().Send()
+
+			assert.Equal(t, tc.out, buf.String())
+		})
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	os.Setenv("MY_APP_VERSION", "1.2.3")
+	defer os.Unsetenv("MY_APP_VERSION")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+	app.AddAdmin(9091)
+
+	rec := httptest.NewRecorder()
+	app.httpServers[0].httpHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var info VersionInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, "dev", info.Env)
+	assert.Equal(t, app.VersionInfo().StartTime.Unix(), info.StartTime.Unix())
+}
+
+func TestAppInfoMetrics(t *testing.T) {
+	os.Setenv("MY_APP_VERSION", "1.2.3")
+	defer os.Unsetenv("MY_APP_VERSION")
+
+	app := NewApp(NewAppConfig("MyApp").Build())
+
+	mfs := gatherMetrics(t, app.Metrics)
+
+	require.Contains(t, mfs, "app_info")
+	assert.Equal(t, prometheus.Labels{"version": "1.2.3", "commit": app.VersionInfo().Commit, "env": "dev"}, metricLabels(mfs["app_info"].GetMetric()[0]))
+	assert.Equal(t, 1.0, mfs["app_info"].GetMetric()[0].GetGauge().GetValue())
+
+	require.Contains(t, mfs, "app_uptime_seconds")
+	assert.GreaterOrEqual(t, mfs["app_uptime_seconds"].GetMetric()[0].GetGauge().GetValue(), 0.0)
+
+	require.Contains(t, mfs, "process_start_time_seconds")
+}